@@ -0,0 +1,64 @@
+package niltoempty
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Clone returns a deep copy of v with all nil maps and slices replaced by
+// empty ones, as if by InitializeWith called with opts. The original is left
+// untouched.
+//
+// Pointers, slices and maps referenced more than once are copied once, so
+// shared and cyclic references in v stay shared and cyclic in the clone.
+//
+// Unexported fields are copied as they are, without descending into them, so
+// whatever they refer to is shared between v and the clone and is not
+// initialized. Unexported embedded structs and pointers to them are the
+// exception, as the exported fields of the structs are promoted: they are
+// copied and initialized like exported fields.
+//
+// InitializeNils methods and registered functions are not called, as they may
+// modify what unexported fields refer to; the clone is initialized through
+// reflection instead. When v is a pointer, the options apply to the copy of the
+// value it points to as they would to the value passed to InitializeWith.
+//
+// Clone panics with the error reported by InitializeE when the limit set by
+// WithMaxNodes is exceeded.
+func Clone[T any](v T, opts ...Option) T {
+	var c T
+	if err := initializedCopy(reflect.ValueOf(&c).Elem(), reflect.ValueOf(&v).Elem(), opts); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// initializedCopy stores the deep copy of src in the settable dst and
+// initializes it. ErrUnsettable and ErrMaxDepth are not reported, as they
+// are not reported by InitializeWith either.
+func initializedCopy(dst, src reflect.Value, opts []Option) error {
+	newCopier().copy(dst, src)
+
+	// A copied pointer is the root itself, as the pointer passed to
+	// InitializeWith would be.
+	root := dst.Addr()
+	if dst.Kind() == reflect.Pointer && !dst.IsNil() {
+		root = dst
+	}
+
+	// Unexported fields in the copy still refer to the original values,
+	// so they must not be followed nor modified, by hooks either.
+	opts = append(opts[:len(opts):len(opts)], WithUnexportedPointers(false), WithUnexported(false), withoutHooks())
+	if err := InitializeE(root.Interface(), opts...); err != nil && !errors.Is(err, ErrUnsettable) && !errors.Is(err, ErrMaxDepth) {
+		return err
+	}
+	return nil
+}
+
+// withoutHooks makes the traversal use reflection for values implementing
+// Initializer and for types with registered functions.
+func withoutHooks() Option {
+	return func(o *options) {
+		o.noHooks = true
+	}
+}
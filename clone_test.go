@@ -0,0 +1,143 @@
+package niltoempty_test
+
+import (
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	type (
+		Inner struct {
+			S []int
+			M map[string][]int
+		}
+		Outer struct {
+			I       Inner
+			P       *Inner
+			Q       *Inner
+			L       []Inner
+			A       [2]map[string]int
+			Any     any
+			private *Inner
+		}
+	)
+
+	t.Run("deep copy is initialized", func(t *testing.T) {
+		v := Outer{
+			P:   &Inner{M: map[string][]int{"a": nil}},
+			L:   []Inner{{S: []int{1}}},
+			Any: []any{map[string]any(nil)},
+		}
+
+		c := niltoempty.Clone(v)
+
+		assert.NotNil(t, c.I.S)
+		assert.NotNil(t, c.I.M)
+		assert.NotNil(t, c.P.S)
+		assert.NotNil(t, c.P.M["a"])
+		assert.NotNil(t, c.L[0].M)
+		assert.NotNil(t, c.A[0])
+		assert.NotNil(t, c.Any.([]any)[0])
+		assert.Nil(t, c.Q)
+
+		// The original is untouched.
+		assert.Nil(t, v.I.S)
+		assert.Nil(t, v.P.S)
+		assert.Nil(t, v.P.M["a"])
+		assert.Nil(t, v.L[0].M)
+		assert.Nil(t, v.Any.([]any)[0])
+
+		// And doesn't share anything with the clone.
+		assert.NotSame(t, v.P, c.P)
+		c.L[0].S[0] = 2
+		assert.Equal(t, 1, v.L[0].S[0])
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		v := &Inner{}
+
+		c := niltoempty.Clone(v)
+
+		assert.NotSame(t, v, c)
+		assert.NotNil(t, c.S)
+		assert.Nil(t, v.S)
+
+		// The options apply to the value pointed to, as with InitializeWith.
+		c = niltoempty.Clone(v, niltoempty.WithPointers(false))
+		assert.NotNil(t, c.S)
+	})
+
+	t.Run("shared references stay shared", func(t *testing.T) {
+		shared := &Inner{}
+		backing := []int{1, 2, 3}
+		v := struct {
+			A, B   *Inner
+			Short  []int
+			Long   []int
+			M1, M2 map[string][]int
+		}{
+			A:     shared,
+			B:     shared,
+			Short: backing[:1],
+			Long:  backing,
+			M1:    map[string][]int{"a": nil},
+		}
+		v.M2 = v.M1
+
+		c := niltoempty.Clone(v)
+
+		assert.Same(t, c.A, c.B)
+		assert.NotSame(t, shared, c.A)
+		assert.Len(t, c.Short, 1)
+		assert.Len(t, c.Long, 3)
+		c.M1["b"] = []int{}
+		assert.Len(t, c.M2, 2)
+		assert.Len(t, v.M1, 1)
+	})
+
+	t.Run("cyclic", func(t *testing.T) {
+		type Node struct {
+			S    []int
+			Next *Node
+		}
+		v := &Node{}
+		v.Next = &Node{Next: v}
+
+		c := niltoempty.Clone(v)
+
+		require.NotNil(t, c.Next)
+		assert.Same(t, c, c.Next.Next)
+		assert.NotSame(t, v, c)
+		assert.NotNil(t, c.S)
+		assert.NotNil(t, c.Next.S)
+		assert.Nil(t, v.S)
+	})
+
+	t.Run("unexported fields are shared", func(t *testing.T) {
+		v := Outer{private: &Inner{}}
+
+		c := niltoempty.Clone(v)
+
+		assert.Same(t, v.private, c.private)
+		assert.Nil(t, v.private.S)
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		var v any = map[string]any{"a": []int(nil)}
+
+		c := niltoempty.Clone(v)
+
+		assert.NotNil(t, c.(map[string]any)["a"])
+		assert.Nil(t, v.(map[string]any)["a"])
+	})
+
+	t.Run("options", func(t *testing.T) {
+		c := niltoempty.Clone(Inner{}, niltoempty.WithMaps(false))
+
+		assert.NotNil(t, c.S)
+		assert.Nil(t, c.M)
+	})
+}
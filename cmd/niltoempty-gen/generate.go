@@ -0,0 +1,718 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// annotation marks the types for which the methods are generated.
+	annotation = "//niltoempty:generate"
+
+	niltoemptyPath = "github.com/pkierski/niltoempty"
+)
+
+// generate returns the source of the file with the InitializeNils methods for
+// the package in dir. The methods are generated for the named types, or for
+// the annotated ones when names is empty. The file output is not read, as it
+// holds the result of a previous run.
+func generate(dir string, names []string, output string) ([]byte, error) {
+	fset := token.NewFileSet()
+	files, err := parsePackage(fset, dir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(files[0].Name.Name, fset, files, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		names = annotated(files)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no types annotated with %s in %s", annotation, dir)
+		}
+	}
+
+	g := &generator{
+		pkg:      pkg,
+		imports:  map[string]string{},
+		methods:  map[*types.Named]bool{},
+		inlining: map[types.Type]bool{},
+		buf:      &bytes.Buffer{},
+	}
+	var selected []*types.Named
+	for _, name := range names {
+		t, err := g.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		g.methods[t] = true
+		selected = append(selected, t)
+	}
+	for _, t := range selected {
+		g.method(t)
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.file()
+}
+
+// parsePackage parses the non-test Go files of the package in dir, skipping
+// the output file and the files excluded by build constraints.
+func parsePackage(fset *token.FileSet, dir, output string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == output {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 && f.Name.Name != files[0].Name.Name {
+			return nil, fmt.Errorf("multiple packages in %s: %s and %s", dir, files[0].Name.Name, f.Name.Name)
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	return files, nil
+}
+
+// annotated returns the names of the types annotated for generation, in the
+// order of declaration.
+func annotated(files []*ast.File) []string {
+	var names []string
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				if hasAnnotation(doc) {
+					names = append(names, ts.Name.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+func hasAnnotation(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// generator writes the InitializeNils methods.
+type generator struct {
+	pkg *types.Package
+
+	// imports maps the paths of the packages referred to by the generated
+	// code to their names.
+	imports map[string]string
+
+	// methods holds the types for which the methods are generated.
+	methods map[*types.Named]bool
+
+	// inlining holds the struct types whose fields are being processed in
+	// place, to fall back to reflection for types referring to themselves.
+	inlining map[types.Type]bool
+
+	// changed names the flag set by the code modifying the copy of a map
+	// value being processed, so the copy is written back only when needed.
+	// It's empty when the value being processed is not such a copy, e.g.
+	// when it's reached through a pointer.
+	changed string
+
+	// changedDepth is the nesting of the code processing the map value,
+	// and always records an unconditional modification of its copy.
+	changedDepth int
+	always       bool
+
+	// depth is the nesting of the code being written.
+	depth int
+
+	buf  *bytes.Buffer
+	vars int
+	err  error
+}
+
+// lookup returns the struct type name declared in the package.
+func (g *generator) lookup(name string) (*types.Named, error) {
+	obj, ok := g.pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in package %s", name, g.pkg.Name())
+	}
+	t, ok := obj.Type().(*types.Named)
+	if !ok || obj.IsAlias() {
+		return nil, fmt.Errorf("%s is not a defined type", name)
+	}
+	if _, ok := t.Underlying().(*types.Struct); !ok {
+		return nil, fmt.Errorf("%s is not a struct type", name)
+	}
+	if t.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("%s: generic types are not supported", name)
+	}
+	if m, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, g.pkg, "InitializeNils"); m != nil {
+		return nil, fmt.Errorf("%s already has InitializeNils", name)
+	}
+	return t, nil
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	if strings.HasPrefix(line, "}") {
+		g.depth--
+	}
+	if strings.HasSuffix(line, "{") {
+		g.depth++
+	}
+	g.buf.WriteString(line)
+	g.buf.WriteByte('\n')
+}
+
+// capture returns the code written by f instead of writing it.
+func (g *generator) capture(f func()) string {
+	saved := g.buf
+	g.buf = &bytes.Buffer{}
+	f()
+	s := g.buf.String()
+	g.buf = saved
+	return s
+}
+
+// assigned writes the code marking the copy of the map value being processed
+// as changed, after an assignment or a call which may modify it.
+func (g *generator) assigned() {
+	switch {
+	case g.changed == "":
+	case g.depth == g.changedDepth:
+		g.always = true
+	default:
+		g.printf("%s = true", g.changed)
+	}
+}
+
+// shared writes the code of f for values shared with the map value being
+// processed, e.g. reached through a pointer, which are modified in place.
+func (g *generator) shared(f func()) {
+	saved := g.changed
+	g.changed = ""
+	f()
+	g.changed = saved
+}
+
+// fail records the first error.
+func (g *generator) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// newVar returns a fresh name for a local variable.
+func (g *generator) newVar(prefix string) string {
+	g.vars++
+	return prefix + strconv.Itoa(g.vars)
+}
+
+// qualifier refers to the types of other packages by package name.
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	g.imports[p.Path()] = p.Name()
+	return p.Name()
+}
+
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// method writes the InitializeNils method of t.
+func (g *generator) method(t *types.Named) {
+	g.vars = 0
+	g.printf("// InitializeNils replaces the nil maps and slices held by x with empty ones.")
+	g.printf("func (x *%s) InitializeNils() {", t.Obj().Name())
+	g.printf("if x == nil {")
+	g.printf("return")
+	g.printf("}")
+	g.inlining[t] = true
+	g.fields("x", t.Underlying().(*types.Struct))
+	delete(g.inlining, t)
+	g.printf("}")
+	g.printf("")
+}
+
+// fields writes the code for the exported fields of the struct expr.
+func (g *generator) fields(expr string, st *types.Struct) {
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if !g.visible(f) {
+			continue
+		}
+		tag := parseTag(st.Tag(i))
+		if tag.skip {
+			continue
+		}
+		g.emit(expr+"."+f.Name(), f.Type(), tag)
+	}
+}
+
+// emit writes the code for the addressable value expr of type t.
+func (g *generator) emit(expr string, t types.Type, tag fieldTag) {
+	if g.hasInitializer(t) {
+		if !tag.shallow {
+			g.printf("%s.InitializeNils()", expr)
+			g.assigned()
+		}
+		return
+	}
+
+	if g.encodesItself(t) {
+		return
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Slice:
+		g.printf("if %s == nil {", expr)
+		g.printf("%s = %s", expr, g.empty(t, tag.cap))
+		g.assigned()
+		if !tag.shallow && g.needsWork(u.Elem()) {
+			i := g.newVar("i")
+			g.printf("} else {")
+			g.printf("for %s := range %s {", i, expr)
+			g.shared(func() { g.emit(expr+"["+i+"]", u.Elem(), fieldTag{}) })
+			g.printf("}")
+		}
+		g.printf("}")
+
+	case *types.Map:
+		g.printf("if %s == nil {", expr)
+		g.printf("%s = %s", expr, g.empty(t, tag.cap))
+		g.assigned()
+		if !tag.shallow && g.needsWork(u.Elem()) {
+			g.printf("} else {")
+			g.mapValues(expr, u)
+		}
+		g.printf("}")
+
+	case *types.Pointer:
+		g.pointer(expr, u.Elem(), tag)
+
+	case *types.Array:
+		if tag.shallow || !g.needsWork(u.Elem()) {
+			return
+		}
+		i := g.newVar("i")
+		g.printf("for %s := range %s {", i, expr)
+		g.emit(expr+"["+i+"]", u.Elem(), fieldTag{})
+		g.printf("}")
+
+	case *types.Struct:
+		if tag.shallow {
+			return
+		}
+		if g.inlining[t] {
+			g.fallback("&" + expr)
+			return
+		}
+		g.inlining[t] = true
+		g.fields(expr, u)
+		delete(g.inlining, t)
+
+	case *types.Interface:
+		if tag.shallow {
+			return
+		}
+		g.printf("if %s != nil {", expr)
+		g.fallback("&" + expr)
+		g.printf("}")
+	}
+}
+
+// mapValues writes the loop processing the values of the non-nil map expr of
+// type m. Values held directly are processed as copies, written back only when
+// changed, so the map doesn't grow while being iterated over. Keys not equal to
+// themselves, e.g. NaN, can't be written back to at all, so their values are
+// skipped.
+func (g *generator) mapValues(expr string, m *types.Map) {
+	v := g.newVar("v")
+	if _, ok := m.Elem().Underlying().(*types.Pointer); ok {
+		// The values pointed to are updated in place.
+		g.printf("for _, %s := range %s {", v, expr)
+		g.shared(func() { g.emit(v, m.Elem(), fieldTag{}) })
+		g.printf("}")
+		return
+	}
+
+	k := g.newVar("k")
+	changed := g.newVar("changed")
+	vars := g.vars
+	body, always := g.mapValue(v, m.Elem(), changed)
+	if always {
+		// The copy is written back in any case, so the flag isn't needed.
+		g.vars = vars
+		body, _ = g.mapValue(v, m.Elem(), "")
+	}
+	flagged := !always && strings.Contains(body, changed+" = true")
+	irreflexive := mayBeIrreflexive(m.Key())
+
+	if !always && !flagged && !irreflexive {
+		g.printf("for _, %s := range %s {", v, expr)
+		g.buf.WriteString(body)
+		g.printf("}")
+		return
+	}
+	g.printf("for %s, %s := range %s {", k, v, expr)
+	if irreflexive {
+		g.printf("if %s != %s {", k, k)
+		g.printf("continue")
+		g.printf("}")
+	}
+	switch {
+	case always:
+		g.buf.WriteString(body)
+		g.printf("%s[%s] = %s", expr, k, v)
+	case flagged:
+		g.printf("%s := false", changed)
+		g.buf.WriteString(body)
+		g.printf("if %s {", changed)
+		g.printf("%s[%s] = %s", expr, k, v)
+		g.printf("}")
+	default:
+		g.buf.WriteString(body)
+	}
+	g.printf("}")
+}
+
+// mapValue returns the code processing the copy v of a map value of type t,
+// setting the flag changed when the copy is modified. It also reports whether
+// the copy is modified unconditionally.
+func (g *generator) mapValue(v string, t types.Type, changed string) (string, bool) {
+	saved, savedDepth, savedAlways := g.changed, g.changedDepth, g.always
+	g.changed, g.changedDepth, g.always = changed, g.depth, false
+	body := g.capture(func() { g.emit(v, t, fieldTag{}) })
+	always := g.always
+	g.changed, g.changedDepth, g.always = saved, savedDepth, savedAlways
+	return body, always
+}
+
+// pointer writes the code for the pointer expr to a value of type elem.
+func (g *generator) pointer(expr string, elem types.Type, tag fieldTag) {
+	// The tag applies to the value pointed to, which is modified in place.
+	var body string
+	g.shared(func() {
+		body = g.capture(func() {
+			st, isStruct := elem.Underlying().(*types.Struct)
+			switch {
+			case g.hasInitializer(elem):
+				if !tag.shallow {
+					g.printf("%s.InitializeNils()", expr)
+				}
+			case isStruct && g.inlining[elem]:
+				if !tag.shallow {
+					g.fallback(expr)
+				}
+			case isStruct:
+				// Selectors dereference the pointer implicitly.
+				if !tag.shallow {
+					g.inlining[elem] = true
+					g.fields(expr, st)
+					delete(g.inlining, elem)
+				}
+			case tag.shallow || tag.cap > 0 || g.needsWork(elem):
+				g.emit("(*"+expr+")", elem, fieldTag{shallow: tag.shallow, cap: tag.cap})
+			}
+		})
+	})
+
+	if tag.alloc && g.allocatable(elem) {
+		if st, ok := elem.Underlying().(*types.Struct); ok && g.allocates(st, map[types.Type]bool{}) {
+			g.fail(fmt.Errorf("%s: alloc of %s which allocates pointers to structs itself is not supported", expr, g.typeString(elem)))
+			return
+		}
+		g.printf("if %s == nil {", expr)
+		g.printf("%s = new(%s)", expr, g.typeString(elem))
+		g.assigned()
+		g.printf("}")
+		g.buf.WriteString(body)
+		return
+	}
+	if body != "" {
+		g.printf("if %s != nil {", expr)
+		g.buf.WriteString(body)
+		g.printf("}")
+	}
+}
+
+// fallback writes the code processing the pointer expr with niltoempty.Initialize.
+func (g *generator) fallback(expr string) {
+	g.imports[niltoemptyPath] = "niltoempty"
+	g.printf("niltoempty.Initialize(%s)", expr)
+	g.assigned()
+}
+
+// empty returns the expression creating an empty slice or map of type t.
+func (g *generator) empty(t types.Type, n int) string {
+	ts := g.typeString(t)
+	if n <= 0 {
+		return ts + "{}"
+	}
+	if _, ok := t.Underlying().(*types.Slice); ok {
+		return fmt.Sprintf("make(%s, 0, %d)", ts, n)
+	}
+	return fmt.Sprintf("make(%s, %d)", ts, n)
+}
+
+// hasInitializer reports whether the pointer to t has the InitializeNils method,
+// including the ones being generated.
+func (g *generator) hasInitializer(t types.Type) bool {
+	if n, ok := t.(*types.Named); ok && g.methods[n] {
+		return true
+	}
+	if types.IsInterface(t) {
+		return false
+	}
+	m, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, g.pkg, "InitializeNils")
+	fn, ok := m.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 0
+}
+
+// encodesItself reports whether t is a slice or map type implementing
+// json.Marshaler or encoding.TextMarshaler, which niltoempty.Initialize
+// leaves untouched by default.
+func (g *generator) encodesItself(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Slice, *types.Map:
+	default:
+		return false
+	}
+	for _, name := range []string{"MarshalJSON", "MarshalText"} {
+		if m, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, g.pkg, name); m != nil {
+			if _, ok := m.(*types.Func); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allocatable reports whether the alloc tag applies to pointers to t.
+func (g *generator) allocatable(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Slice, *types.Map, *types.Struct:
+		return true
+	}
+	return false
+}
+
+// needsWork reports whether any code has to be generated for a value of type t.
+func (g *generator) needsWork(t types.Type) bool {
+	return g.reaches(t, map[types.Type]bool{})
+}
+
+func (g *generator) reaches(t types.Type, seen map[types.Type]bool) bool {
+	if g.hasInitializer(t) {
+		return true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Slice, *types.Map:
+		return !g.encodesItself(t)
+	case *types.Interface:
+		return true
+	case *types.Pointer:
+		return g.reaches(u.Elem(), seen)
+	case *types.Array:
+		return g.reaches(u.Elem(), seen)
+	case *types.Struct:
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if !g.visible(f) {
+				continue
+			}
+			tag := parseTag(u.Tag(i))
+			if tag.skip {
+				continue
+			}
+			if tag.alloc && isPointer(f.Type()) || g.reaches(f.Type(), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allocates reports whether the struct st holds, directly or not, a field with
+// the alloc tag on a pointer to a struct.
+func (g *generator) allocates(st *types.Struct, seen map[types.Type]bool) bool {
+	if seen[st] {
+		return false
+	}
+	seen[st] = true
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if !g.visible(f) {
+			continue
+		}
+		tag := parseTag(st.Tag(i))
+		if tag.skip {
+			continue
+		}
+		t := f.Type()
+		for {
+			if p, ok := t.Underlying().(*types.Pointer); ok {
+				if _, ok := p.Elem().Underlying().(*types.Struct); ok && tag.alloc {
+					return true
+				}
+				t = p.Elem()
+				tag = fieldTag{}
+				continue
+			}
+			switch u := t.Underlying().(type) {
+			case *types.Slice:
+				t = u.Elem()
+				continue
+			case *types.Map:
+				t = u.Elem()
+				continue
+			case *types.Array:
+				t = u.Elem()
+				continue
+			}
+			break
+		}
+		if s, ok := t.Underlying().(*types.Struct); ok && g.allocates(s, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible reports whether the generated code processes the field f: exported
+// fields and unexported embedded structs of the package, whose exported fields
+// are promoted.
+func (g *generator) visible(f *types.Var) bool {
+	if f.Exported() {
+		return true
+	}
+	if !f.Embedded() || f.Pkg() != g.pkg {
+		return false
+	}
+	t := f.Type()
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
+
+// mayBeIrreflexive reports whether values of type t may not be equal to
+// themselves, as floats holding NaN, the same way niltoempty.Initialize does.
+func mayBeIrreflexive(t types.Type) bool {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return u.Info()&(types.IsFloat|types.IsComplex) != 0
+	case *types.Interface:
+		return true
+	case *types.Array:
+		return mayBeIrreflexive(u.Elem())
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if mayBeIrreflexive(u.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isPointer(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Pointer)
+	return ok
+}
+
+// file returns the formatted source of the generated file.
+func (g *generator) file() ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by niltoempty-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", g.pkg.Name())
+
+	if len(g.imports) > 0 {
+		// The standard library goes first, the way goimports groups them.
+		var std, other []string
+		for p := range g.imports {
+			if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+				other = append(other, p)
+			} else {
+				std = append(std, p)
+			}
+		}
+		sort.Strings(std)
+		sort.Strings(other)
+		out.WriteString("import (\n")
+		for i, group := range [][]string{std, other} {
+			if i > 0 && len(std) > 0 && len(other) > 0 {
+				out.WriteString("\n")
+			}
+			for _, p := range group {
+				fmt.Fprintf(&out, "%s\n", strconv.Quote(p))
+			}
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, errors.New("generated invalid code: " + err.Error())
+	}
+	return src, nil
+}
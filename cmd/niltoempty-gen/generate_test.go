@@ -0,0 +1,151 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePackage writes a package with a single file holding src into a new
+// temporary directory.
+func writePackage(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "types.go"), []byte(src), 0o644))
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("example is up to date", func(t *testing.T) {
+		dir := filepath.Join("internal", "example")
+		want, err := os.ReadFile(filepath.Join(dir, defaultOutput))
+		require.NoError(t, err)
+
+		got, err := generate(dir, nil, defaultOutput)
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got), "run go generate in %s", dir)
+	})
+
+	t.Run("parses", func(t *testing.T) {
+		dir := writePackage(t, `package p
+
+import "encoding/json"
+
+//niltoempty:generate
+type A struct {
+	S   []string
+	M   map[string]*B
+	Raw json.RawMessage
+	B
+	s   []int
+}
+
+type B struct {
+	A *A
+	I interface{}
+}
+
+// C isn't annotated.
+type C struct {
+	S []int
+}
+`)
+		src, err := generate(dir, nil, defaultOutput)
+		require.NoError(t, err)
+
+		f, err := parser.ParseFile(token.NewFileSet(), defaultOutput, src, 0)
+		require.NoError(t, err, "%s", src)
+		assert.Equal(t, "p", f.Name.Name)
+		require.Len(t, f.Decls, 2, "%s", src)
+
+		s := string(src)
+		assert.Contains(t, s, "func (x *A) InitializeNils()")
+		assert.NotContains(t, s, "func (x *C)")
+		assert.NotContains(t, s, "x.s")
+		// Types encoding themselves are left alone.
+		assert.NotContains(t, s, "x.Raw")
+		assert.Contains(t, s, "v1.A.InitializeNils()")
+		assert.Contains(t, s, "niltoempty.Initialize(&x.B.I)")
+	})
+
+	t.Run("listed types", func(t *testing.T) {
+		dir := writePackage(t, `package p
+
+type A struct{ S []int }
+
+type B struct{ M map[int]int }
+`)
+		src, err := generate(dir, []string{"B"}, defaultOutput)
+		require.NoError(t, err)
+		assert.Contains(t, string(src), "func (x *B) InitializeNils()")
+		assert.NotContains(t, string(src), "func (x *A)")
+	})
+
+	t.Run("output is skipped", func(t *testing.T) {
+		dir := writePackage(t, `package p
+
+//niltoempty:generate
+type A struct{ S []int }
+`)
+		src, err := generate(dir, nil, defaultOutput)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, defaultOutput), src, 0o644))
+
+		again, err := generate(dir, nil, defaultOutput)
+		require.NoError(t, err)
+		assert.Equal(t, string(src), string(again))
+	})
+
+	errorTests := map[string]struct {
+		src   string
+		names []string
+		err   string
+	}{
+		"no annotations": {
+			src: "package p\n\ntype A struct{ S []int }\n",
+			err: "no types annotated",
+		},
+		"unknown type": {
+			src:   "package p\n",
+			names: []string{"A"},
+			err:   "type A not found",
+		},
+		"not a struct": {
+			src:   "package p\n\ntype A []int\n",
+			names: []string{"A"},
+			err:   "A is not a struct type",
+		},
+		"generic": {
+			src:   "package p\n\ntype A[T any] struct{ S []T }\n",
+			names: []string{"A"},
+			err:   "generic types are not supported",
+		},
+		"existing method": {
+			src:   "package p\n\ntype A struct{}\n\nfunc (*A) InitializeNils() {}\n",
+			names: []string{"A"},
+			err:   "A already has InitializeNils",
+		},
+		"recursive alloc": {
+			src:   "package p\n\ntype A struct {\n\tNext *A `niltoempty:\"alloc\"`\n}\n",
+			names: []string{"A"},
+			err:   "not supported",
+		},
+		"type error": {
+			src: "package p\n\n//niltoempty:generate\ntype A struct{ S []Missing }\n",
+			err: "undefined: Missing",
+		},
+	}
+	for name, tt := range errorTests {
+		t.Run(name, func(t *testing.T) {
+			dir := writePackage(t, tt.src)
+			_, err := generate(dir, tt.names, defaultOutput)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Package example holds types with generated InitializeNils methods, checked
+// against niltoempty.Initialize in the tests.
+package example
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"time"
+)
+
+//go:generate go run github.com/pkierski/niltoempty/cmd/niltoempty-gen
+
+// Response is a typical API response.
+//
+//niltoempty:generate
+type Response struct {
+	Items   []Item
+	ByID    map[string]Item
+	Refs    map[string]*Item
+	Scores  map[float64][]int
+	Matrix  [][]int
+	Grid    [2][]string
+	Next    *Page
+	Created time.Time
+	Query   url.Values
+	Any     interface{}
+	Meta    *map[string]string `niltoempty:"alloc"`
+	Buffer  []byte             `niltoempty:"cap=16"`
+	Cache   map[string]string  `niltoempty:"-"`
+	Shallow []Item             `niltoempty:"shallow"`
+	Node    *Node
+	Raw     json.RawMessage
+	Addr    net.IP
+	Embedded
+	meta
+	*links
+
+	hidden []int
+}
+
+// Item is an element of the response.
+//
+//niltoempty:generate
+type Item struct {
+	Name   string
+	Tags   []string
+	Labels map[string]string
+}
+
+// Page links to another page of the results.
+type Page struct {
+	Cursor string
+	Items  []Item
+}
+
+// Node refers to itself without having InitializeNils.
+type Node struct {
+	Children []Node
+	Parent   *Node
+}
+
+// Embedded is embedded into Response.
+type Embedded struct {
+	Notes []string
+}
+
+// meta is embedded into Response, its fields are promoted.
+type meta struct {
+	Version int
+	Tags    []string
+	ids     []int
+}
+
+// links is embedded into Response through a pointer.
+type links struct {
+	Self *Page
+}
+
+// SetSelf sets the link to the page itself.
+func (r *Response) SetSelf(p *Page) {
+	r.links = &links{Self: p}
+}
@@ -0,0 +1,121 @@
+package example_test
+
+import (
+	"math"
+	"net/url"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/pkierski/niltoempty/cmd/niltoempty-gen/internal/example"
+	"github.com/stretchr/testify/assert"
+)
+
+func newResponse() example.Response {
+	r := example.Response{
+		Items:   []example.Item{{Name: "a"}, {Tags: []string{"t"}}},
+		ByID:    map[string]example.Item{"a": {}},
+		Refs:    map[string]*example.Item{"a": {}, "nil": nil},
+		Matrix:  [][]int{nil, {1}},
+		Next:    &example.Page{Items: []example.Item{{}}},
+		Any:     example.Item{},
+		Shallow: []example.Item{{}},
+		Node:    &example.Node{Children: []example.Node{{}}, Parent: &example.Node{}},
+	}
+	r.SetSelf(&example.Page{})
+	return r
+}
+
+func TestGenerated(t *testing.T) {
+	t.Run("same as reflection", func(t *testing.T) {
+		// The values niltoempty.Initialize would replace, as it calls
+		// the generated methods itself.
+		want := newResponse()
+		want.Items[0].Tags = []string{}
+		want.Items[0].Labels = map[string]string{}
+		want.Items[1].Labels = map[string]string{}
+		want.ByID["a"] = example.Item{Tags: []string{}, Labels: map[string]string{}}
+		*want.Refs["a"] = example.Item{Tags: []string{}, Labels: map[string]string{}}
+		want.Scores = map[float64][]int{}
+		want.Matrix[0] = []int{}
+		want.Grid = [2][]string{{}, {}}
+		want.Next.Items[0] = example.Item{Tags: []string{}, Labels: map[string]string{}}
+		want.Query = url.Values{}
+		want.Any = example.Item{Tags: []string{}, Labels: map[string]string{}}
+		want.Meta = &map[string]string{}
+		want.Buffer = []byte{}
+		want.Node.Children[0].Children = []example.Node{}
+		want.Node.Parent.Children = []example.Node{}
+		want.Notes = []string{}
+		want.Tags = []string{}
+		want.Self.Items = []example.Item{}
+
+		got := newResponse()
+		got.InitializeNils()
+
+		assert.Equal(t, want, got)
+		assert.Empty(t, niltoempty.Find(&got))
+		assert.Equal(t, 16, cap(got.Buffer))
+		assert.Nil(t, got.Cache)
+		assert.Nil(t, got.Shallow[0].Tags)
+		assert.Nil(t, got.Raw)
+		assert.Nil(t, got.Addr)
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		got := example.Response{}
+		got.InitializeNils()
+
+		assert.Empty(t, niltoempty.Find(&got))
+		assert.Equal(t, &map[string]string{}, got.Meta)
+		assert.Nil(t, got.Next)
+		assert.Nil(t, got.Cache)
+		assert.Equal(t, 16, cap(got.Buffer))
+	})
+
+	t.Run("NaN keys", func(t *testing.T) {
+		got := example.Response{Scores: map[float64][]int{math.NaN(): nil, 1: nil, 2: {2}}}
+		got.InitializeNils()
+
+		assert.Len(t, got.Scores, 3)
+		assert.Equal(t, []int{}, got.Scores[1])
+		assert.Equal(t, []int{2}, got.Scores[2])
+		for k, v := range got.Scores {
+			if k != k {
+				assert.Nil(t, v)
+			}
+		}
+
+		niltoempty.Initialize(&got)
+		assert.Len(t, got.Scores, 3)
+	})
+
+	t.Run("options honored by Initialize", func(t *testing.T) {
+		v := []example.Item{{}}
+		niltoempty.InitializeWith(&v, niltoempty.WithSlices(false))
+
+		assert.Nil(t, v[0].Tags)
+		assert.Equal(t, map[string]string{}, v[0].Labels)
+	})
+
+	t.Run("cycles handled by Initialize", func(t *testing.T) {
+		// Response can lead back to itself through the interface, so
+		// Initialize doesn't hand it over to the generated method.
+		v := example.Response{}
+		v.Any = &v
+		niltoempty.Initialize(&v)
+
+		assert.Empty(t, niltoempty.Find(&v))
+	})
+
+	t.Run("nil receiver", func(t *testing.T) {
+		var r *example.Response
+		assert.NotPanics(t, r.InitializeNils)
+	})
+
+	t.Run("called by Initialize", func(t *testing.T) {
+		v := []example.Response{{}}
+		niltoempty.Initialize(&v)
+
+		assert.Empty(t, niltoempty.Find(&v))
+	})
+}
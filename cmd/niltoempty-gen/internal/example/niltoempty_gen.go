@@ -0,0 +1,151 @@
+// Code generated by niltoempty-gen. DO NOT EDIT.
+
+package example
+
+import (
+	"net/url"
+
+	"github.com/pkierski/niltoempty"
+)
+
+// InitializeNils replaces the nil maps and slices held by x with empty ones.
+func (x *Response) InitializeNils() {
+	if x == nil {
+		return
+	}
+	if x.Items == nil {
+		x.Items = []Item{}
+	} else {
+		for i1 := range x.Items {
+			x.Items[i1].InitializeNils()
+		}
+	}
+	if x.ByID == nil {
+		x.ByID = map[string]Item{}
+	} else {
+		for k3, v2 := range x.ByID {
+			v2.InitializeNils()
+			x.ByID[k3] = v2
+		}
+	}
+	if x.Refs == nil {
+		x.Refs = map[string]*Item{}
+	} else {
+		for _, v5 := range x.Refs {
+			if v5 != nil {
+				v5.InitializeNils()
+			}
+		}
+	}
+	if x.Scores == nil {
+		x.Scores = map[float64][]int{}
+	} else {
+		for k7, v6 := range x.Scores {
+			if k7 != k7 {
+				continue
+			}
+			changed8 := false
+			if v6 == nil {
+				v6 = []int{}
+				changed8 = true
+			}
+			if changed8 {
+				x.Scores[k7] = v6
+			}
+		}
+	}
+	if x.Matrix == nil {
+		x.Matrix = [][]int{}
+	} else {
+		for i9 := range x.Matrix {
+			if x.Matrix[i9] == nil {
+				x.Matrix[i9] = []int{}
+			}
+		}
+	}
+	for i10 := range x.Grid {
+		if x.Grid[i10] == nil {
+			x.Grid[i10] = []string{}
+		}
+	}
+	if x.Next != nil {
+		if x.Next.Items == nil {
+			x.Next.Items = []Item{}
+		} else {
+			for i11 := range x.Next.Items {
+				x.Next.Items[i11].InitializeNils()
+			}
+		}
+	}
+	if x.Query == nil {
+		x.Query = url.Values{}
+	} else {
+		for k13, v12 := range x.Query {
+			changed14 := false
+			if v12 == nil {
+				v12 = []string{}
+				changed14 = true
+			}
+			if changed14 {
+				x.Query[k13] = v12
+			}
+		}
+	}
+	if x.Any != nil {
+		niltoempty.Initialize(&x.Any)
+	}
+	if x.Meta == nil {
+		x.Meta = new(map[string]string)
+	}
+	if (*x.Meta) == nil {
+		(*x.Meta) = map[string]string{}
+	}
+	if x.Buffer == nil {
+		x.Buffer = make([]byte, 0, 16)
+	}
+	if x.Shallow == nil {
+		x.Shallow = []Item{}
+	}
+	if x.Node != nil {
+		if x.Node.Children == nil {
+			x.Node.Children = []Node{}
+		} else {
+			for i15 := range x.Node.Children {
+				niltoempty.Initialize(&x.Node.Children[i15])
+			}
+		}
+		if x.Node.Parent != nil {
+			niltoempty.Initialize(x.Node.Parent)
+		}
+	}
+	if x.Embedded.Notes == nil {
+		x.Embedded.Notes = []string{}
+	}
+	if x.meta.Tags == nil {
+		x.meta.Tags = []string{}
+	}
+	if x.links != nil {
+		if x.links.Self != nil {
+			if x.links.Self.Items == nil {
+				x.links.Self.Items = []Item{}
+			} else {
+				for i16 := range x.links.Self.Items {
+					x.links.Self.Items[i16].InitializeNils()
+				}
+			}
+		}
+	}
+}
+
+// InitializeNils replaces the nil maps and slices held by x with empty ones.
+func (x *Item) InitializeNils() {
+	if x == nil {
+		return
+	}
+	if x.Tags == nil {
+		x.Tags = []string{}
+	}
+	if x.Labels == nil {
+		x.Labels = map[string]string{}
+	}
+}
@@ -0,0 +1,89 @@
+// Command niltoempty-gen generates InitializeNils methods replacing nil maps and
+// slices without reflection.
+//
+// The methods are generated for the struct types of a package annotated with
+// a //niltoempty:generate comment, or for the types listed with -type:
+//
+//	//niltoempty:generate
+//	type Response struct {
+//		Items []Item `json:"items"`
+//	}
+//
+// Running niltoempty-gen in the package directory, e.g. with
+//
+//	//go:generate niltoempty-gen
+//
+// writes niltoempty_gen.go with a method for each of those types:
+//
+//	func (x *Response) InitializeNils()
+//
+// The methods implement niltoempty.Initializer, so niltoempty.Initialize calls
+// them instead of traversing the values through reflection, as long as it runs
+// with the default options and the types can't lead back to themselves; see
+// niltoempty.Initializer.
+//
+// The generated code follows the default options of niltoempty.Initialize: nil
+// maps and slices in exported fields are replaced, pointers are followed,
+// channels are left nil, slices and maps of types implementing json.Marshaler
+// or encoding.TextMarshaler are left alone and the niltoempty struct tags are
+// honored. The alloc tag is rejected on pointers to structs holding such fields
+// themselves. Values held in interfaces are passed to niltoempty.Initialize,
+// and so are values of types referring to themselves without InitializeNils
+// methods.
+//
+// Unlike niltoempty.Initialize, the generated methods don't detect cycles:
+// they must not be used for values in which a pointer, map or slice leads back
+// to a value already being processed, when called directly.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultOutput = "niltoempty_gen.go"
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("niltoempty-gen: ")
+
+	typeNames := flag.String("type", "", "comma-separated list of type names; defaults to the types annotated with //niltoempty:generate")
+	output := flag.String("output", "", "output file name; defaults to "+defaultOutput+" in the package directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: niltoempty-gen [flags] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		dir = flag.Arg(0)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out := *output
+	if out == "" {
+		out = filepath.Join(dir, defaultOutput)
+	}
+
+	var names []string
+	if *typeNames != "" {
+		names = strings.Split(*typeNames, ",")
+	}
+
+	src, err := generate(dir, names, filepath.Base(out))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// fieldTag is the parsed niltoempty struct tag, as documented in the niltoempty
+// package.
+type fieldTag struct {
+	skip    bool
+	shallow bool
+	alloc   bool
+	cap     int
+}
+
+// parseTag parses the niltoempty tag of a field. Unknown or malformed options
+// are ignored, the same way niltoempty.Initialize does.
+func parseTag(tag string) fieldTag {
+	var ft fieldTag
+
+	value, ok := reflect.StructTag(tag).Lookup("niltoempty")
+	if !ok {
+		return ft
+	}
+	if value == "-" {
+		ft.skip = true
+		return ft
+	}
+
+	for _, opt := range strings.Split(value, ",") {
+		switch {
+		case opt == "shallow":
+			ft.shallow = true
+		case opt == "alloc":
+			ft.alloc = true
+		case strings.HasPrefix(opt, "cap="):
+			if n, err := strconv.Atoi(strings.TrimPrefix(opt, "cap=")); err == nil && n > 0 {
+				ft.cap = n
+			}
+		}
+	}
+	return ft
+}
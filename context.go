@@ -0,0 +1,24 @@
+package niltoempty
+
+import (
+	"context"
+)
+
+// ctxCheckInterval is the number of values visited between the checks of
+// the context passed to InitializeContext.
+const ctxCheckInterval = 1024
+
+// InitializeContext works like InitializeE, but it stops the traversal once
+// ctx is done, leaving the rest of obj untouched. The context is checked
+// before the traversal and periodically during it, as the traversal visits
+// slice and map elements, struct fields and values pointed to.
+//
+// The error of ctx is returned as it is when ctx is done before the traversal
+// starts, and as *PathError holding the path where the traversal stopped
+// otherwise. Either way, errors.Is(err, ctx.Err()) holds.
+func InitializeContext(ctx context.Context, obj interface{}, opts ...Option) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return initializeE(ctx, obj, opts)
+}
@@ -0,0 +1,78 @@
+package niltoempty_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializeContext(t *testing.T) {
+	type (
+		trigger struct{}
+		Item    struct {
+			Trigger trigger
+			S       []int
+		}
+	)
+
+	t.Run("background", func(t *testing.T) {
+		v := []Item{{}}
+		require.NoError(t, niltoempty.InitializeContext(context.Background(), &v))
+		assert.Equal(t, []int{}, v[0].S)
+	})
+
+	t.Run("done before", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		v := []Item{{}}
+		err := niltoempty.InitializeContext(ctx, &v)
+		assert.Equal(t, context.Canceled, err)
+		assert.Nil(t, v[0].S)
+	})
+
+	t.Run("canceled during", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The first element cancels the context when visited.
+		r := niltoempty.NewRegistry()
+		niltoempty.Register(r, func(*trigger) { cancel() })
+
+		v := make([]Item, 10000)
+		err := niltoempty.InitializeContext(ctx, &v, niltoempty.WithRegistry(r))
+		require.ErrorIs(t, err, context.Canceled)
+
+		var pathErr *niltoempty.PathError
+		require.ErrorAs(t, err, &pathErr)
+		assert.NotEmpty(t, pathErr.Path)
+
+		assert.Equal(t, []int{}, v[0].S)
+		assert.Nil(t, v[len(v)-1].S)
+	})
+
+	t.Run("canceled after exceeding depth", func(t *testing.T) {
+		type Deep struct {
+			Item  Item
+			Inner struct{ Inner struct{ S []int } }
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r := niltoempty.NewRegistry()
+		niltoempty.Register(r, func(*trigger) { cancel() })
+
+		v := make([]Deep, 10000)
+		err := niltoempty.InitializeContext(ctx, &v, niltoempty.WithRegistry(r), niltoempty.WithMaxDepth(3))
+		require.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, niltoempty.ErrMaxDepth)
+		assert.Nil(t, v[len(v)-1].Item.S)
+	})
+
+	t.Run("not a pointer", func(t *testing.T) {
+		assert.ErrorIs(t, niltoempty.InitializeContext(context.Background(), Item{}), niltoempty.ErrNotPointer)
+	})
+}
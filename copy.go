@@ -0,0 +1,152 @@
+package niltoempty
+
+import (
+	"reflect"
+)
+
+// copier makes deep copies of values. Pointers, slices and maps referenced
+// more than once are copied once, so shared and cyclic references in the
+// original are shared and cyclic in the copy as well.
+//
+// Unexported fields can't be copied through reflection one by one, so structs
+// are copied as a whole first and only exported fields are then replaced with
+// their deep copies. Whatever unexported fields refer to is shared between the
+// original and the copy.
+type copier struct {
+	copies map[refKey]reflect.Value
+}
+
+// refKey identifies a pointer, slice or map. The type is needed because
+// a pointer to a struct and a pointer to its first field share the address,
+// and the length because slices sharing a backing array may differ in it.
+type refKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// refKeyOf returns the key of v, which must be a non-nil pointer, slice or map.
+func refKeyOf(v reflect.Value) refKey {
+	key := refKey{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	return key
+}
+
+func newCopier() *copier {
+	return &copier{
+		copies: map[refKey]reflect.Value{},
+	}
+}
+
+// copy stores the deep copy of src in dst, which must be settable, of the same
+// type as src and hold the zero value.
+func (c *copier) copy(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		key := refKeyOf(src)
+		if p, ok := c.copies[key]; ok {
+			dst.Set(p)
+			return
+		}
+		p := reflect.New(src.Type().Elem())
+		c.copies[key] = p
+		dst.Set(p)
+		c.copy(p.Elem(), src.Elem())
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		key := refKeyOf(src)
+		if s, ok := c.copies[key]; ok {
+			dst.Set(s)
+			return
+		}
+		s := reflect.MakeSlice(src.Type(), src.Len(), src.Cap())
+		c.copies[key] = s
+		dst.Set(s)
+		for i := 0; i < src.Len(); i++ {
+			c.copy(s.Index(i), src.Index(i))
+		}
+
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		key := refKeyOf(src)
+		if m, ok := c.copies[key]; ok {
+			dst.Set(m)
+			return
+		}
+		m := reflect.MakeMapWithSize(src.Type(), src.Len())
+		c.copies[key] = m
+		dst.Set(m)
+
+		// Keys are comparable and identify entries, so they are kept as they are.
+		elemType := src.Type().Elem()
+		iter := src.MapRange()
+		for iter.Next() {
+			val := reflect.New(elemType).Elem()
+			c.copy(val, iter.Value())
+			m.SetMapIndex(iter.Key(), val)
+		}
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		elem := src.Elem()
+		val := reflect.New(elem.Type()).Elem()
+		c.copy(val, elem)
+		dst.Set(val)
+
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			c.copy(dst.Index(i), src.Index(i))
+		}
+
+	case reflect.Struct:
+		dst.Set(src)
+		c.copyFields(dst, src)
+
+	default:
+		dst.Set(src)
+	}
+}
+
+// copyFields replaces the exported fields of dst, a shallow copy of src, with
+// deep copies. The exported fields of unexported embedded structs are copied as
+// well, as they can be set although the embedded structs themselves can't.
+// Unexported embedded pointers to structs are replaced with deep copies through
+// package unsafe, as the traversal follows them to initialize the promoted
+// fields.
+func (c *copier) copyFields(dst, src reflect.Value) {
+	t := src.Type()
+	for i := 0; i < src.NumField(); i++ {
+		sf := t.Field(i)
+		switch {
+		case sf.IsExported():
+			field := dst.Field(i)
+			field.Set(reflect.Zero(field.Type()))
+			c.copy(field, src.Field(i))
+		case !isPromoted(sf):
+		case sf.Type.Kind() == reflect.Struct:
+			c.copyFields(dst.Field(i), src.Field(i))
+		case !src.Field(i).IsNil():
+			field, ok := exposed(dst.Field(i))
+			if !ok {
+				continue
+			}
+			// The source field is read only, so the copy is made from
+			// a pointer to the same struct obtained without it.
+			p := reflect.NewAt(sf.Type.Elem(), src.Field(i).UnsafePointer())
+			field.Set(reflect.Zero(field.Type()))
+			c.copy(field, p)
+		}
+	}
+}
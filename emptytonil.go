@@ -0,0 +1,26 @@
+package niltoempty
+
+import (
+	"reflect"
+)
+
+// EmptyToNil is the inverse of Initialize: it replaces all empty maps and
+// slices with nil ones, e.g. to normalize values decoded from JSON where []
+// and {} produce non-nil empty values.
+//
+// It follows the same rules as InitializeWith: obj has to be a pointer,
+// cycles are detected, unexported fields are left untouched and opts as well
+// as niltoempty struct tags apply, except for "alloc" and "cap" which only
+// make sense when creating values.
+func EmptyToNil(obj interface{}, opts ...Option) interface{} {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr {
+		panic("niltoempty: expected pointer")
+	}
+
+	w := newWalker(opts)
+	w.emptyToNil = true
+	w.initializeRoot(v)
+
+	return obj
+}
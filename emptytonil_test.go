@@ -0,0 +1,101 @@
+package niltoempty_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyToNil(t *testing.T) {
+	type (
+		Inner struct {
+			S []int
+			M map[string]int
+		}
+		Outer struct {
+			S       []int
+			M       map[string][]int
+			I       Inner
+			P       *Inner
+			PS      *[]int
+			L       []Inner
+			Any     any
+			Keep    []int   `niltoempty:"-"`
+			Shallow []Inner `niltoempty:"shallow"`
+			Filled  []int
+			private []int
+		}
+	)
+
+	t.Run("from JSON", func(t *testing.T) {
+		var v Outer
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"S": [],
+			"M": {"a": [], "b": [1]},
+			"I": {"S": [], "M": {}},
+			"P": {"S": [], "M": {}},
+			"PS": [],
+			"L": [{"S": []}],
+			"Any": {"x": [], "y": {}},
+			"Keep": [],
+			"Shallow": [{"S": []}],
+			"Filled": [1]
+		}`), &v))
+		v.private = []int{}
+
+		niltoempty.EmptyToNil(&v)
+
+		assert.Nil(t, v.S)
+		assert.Nil(t, v.M["a"])
+		assert.Equal(t, []int{1}, v.M["b"])
+		assert.Nil(t, v.I.S)
+		assert.Nil(t, v.I.M)
+		assert.Nil(t, v.P.S)
+		assert.Nil(t, v.P.M)
+		require.NotNil(t, v.PS, "pointers are left")
+		assert.Nil(t, *v.PS)
+		assert.Nil(t, v.L[0].S)
+		assert.Equal(t, map[string]any{"x": []any(nil), "y": map[string]any(nil)}, v.Any)
+		assert.NotNil(t, v.Keep)
+		assert.NotNil(t, v.Shallow[0].S)
+		assert.Equal(t, []int{1}, v.Filled)
+		assert.NotNil(t, v.private)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		var v Outer
+		niltoempty.Initialize(&v)
+		niltoempty.EmptyToNil(&v)
+
+		assert.Equal(t, Outer{Keep: nil}, v)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		v := Inner{S: []int{}, M: map[string]int{}}
+		niltoempty.EmptyToNil(&v, niltoempty.WithMaps(false))
+
+		assert.Nil(t, v.S)
+		assert.NotNil(t, v.M)
+	})
+
+	t.Run("cyclic", func(t *testing.T) {
+		type C struct {
+			P *C
+			S []int
+		}
+		v := C{S: []int{}}
+		v.P = &v
+
+		niltoempty.EmptyToNil(&v)
+		assert.Nil(t, v.S)
+	})
+
+	t.Run("panics on non-pointer", func(t *testing.T) {
+		assert.Panics(t, func() {
+			niltoempty.EmptyToNil(Inner{})
+		})
+	})
+}
@@ -0,0 +1,640 @@
+package niltoempty
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// An Encoder writes JSON values to an output stream, like json.Encoder, except
+// that nil slices and maps are written as [] and {} instead of null.
+//
+// It follows encoding/json semantics: struct tags (including omitempty and
+// string), embedded structs, json.Marshaler and encoding.TextMarshaler are
+// honored the same way. Nil pointers, including pointers to slices and maps,
+// are still written as null, the same way Initialize leaves them. Nil byte
+// slices are written as "" or null according to the policy set by SetBytes,
+// like Initialize with WithBytes. Unlike Initialize, the value is not modified
+// and it is traversed only once.
+type Encoder struct {
+	w          io.Writer
+	escapeHTML bool
+	bytes      BytesPolicy
+
+	indentPrefix string
+	indentValue  string
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, escapeHTML: true}
+}
+
+// Encode writes the JSON encoding of v to the stream, followed by a newline character.
+func (enc *Encoder) Encode(v interface{}) error {
+	e := encodeState{escapeHTML: enc.escapeHTML, bytes: enc.bytes}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	e.WriteByte('\n')
+
+	b := e.Bytes()
+	if enc.indentPrefix != "" || enc.indentValue != "" {
+		var out bytes.Buffer
+		if err := json.Indent(&out, b, enc.indentPrefix, enc.indentValue); err != nil {
+			return err
+		}
+		b = out.Bytes()
+	}
+	_, err := enc.w.Write(b)
+	return err
+}
+
+// SetIndent instructs the encoder to format each subsequent encoded value as if
+// indented by json.Indent.
+func (enc *Encoder) SetIndent(prefix, indent string) {
+	enc.indentPrefix = prefix
+	enc.indentValue = indent
+}
+
+// SetBytes sets the policy for nil byte slices, written as "" when they would
+// be replaced with empty ones and as null otherwise. BytesEmpty by default.
+func (enc *Encoder) SetBytes(policy BytesPolicy) {
+	enc.bytes = policy
+}
+
+// SetEscapeHTML specifies whether problematic HTML characters should be escaped
+// inside JSON quoted strings. The default behavior is to escape &, <, and >.
+func (enc *Encoder) SetEscapeHTML(on bool) {
+	enc.escapeHTML = on
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	numberType        = reflect.TypeOf(json.Number(""))
+)
+
+// startDetectingCyclesAfter is the nesting level after which pointers are
+// tracked, like in encoding/json, so shallow values don't pay for it.
+const startDetectingCyclesAfter = 1000
+
+// encodeState is the state of a single Encode call.
+type encodeState struct {
+	bytes.Buffer
+	escapeHTML bool
+	bytes      BytesPolicy
+	scratch    [64]byte
+
+	// bytesTag is set while encoding a struct field with the bytes option of
+	// the niltoempty tag, until the value it holds or points to is reached.
+	bytesTag bool
+
+	ptrLevel uint
+	ptrSeen  map[cycleKey]struct{}
+}
+
+// cycleKey identifies a pointer, map or slice being encoded.
+type cycleKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// enter tracks a reference when the nesting is deep enough for a cycle to be
+// likely. The returned function must be called when leaving the value.
+func (e *encodeState) enter(v reflect.Value, key cycleKey) (func(), error) {
+	e.ptrLevel++
+	if e.ptrLevel <= startDetectingCyclesAfter {
+		return e.leave, nil
+	}
+	if _, ok := e.ptrSeen[key]; ok {
+		e.ptrLevel--
+		return nil, &json.UnsupportedValueError{Value: v, Str: fmt.Sprintf("encountered a cycle via %s", v.Type())}
+	}
+	if e.ptrSeen == nil {
+		e.ptrSeen = map[cycleKey]struct{}{}
+	}
+	e.ptrSeen[key] = struct{}{}
+	return func() {
+		delete(e.ptrSeen, key)
+		e.leave()
+	}, nil
+}
+
+func (e *encodeState) leave() {
+	e.ptrLevel--
+}
+
+// encode writes the JSON encoding of v.
+func (e *encodeState) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.WriteString("null")
+		return nil
+	}
+
+	bytesTag := e.bytesTag
+	e.bytesTag = false
+
+	t := v.Type()
+	if t.Kind() != reflect.Pointer && v.CanAddr() {
+		pt := reflect.PointerTo(t)
+		if pt.Implements(marshalerType) {
+			return e.encodeMarshaler(v.Addr())
+		}
+		if pt.Implements(textMarshalerType) {
+			return e.encodeTextMarshaler(v.Addr())
+		}
+	}
+	if t.Kind() != reflect.Interface {
+		if t.Implements(marshalerType) {
+			return e.encodeMarshaler(v)
+		}
+		if t.Implements(textMarshalerType) {
+			return e.encodeTextMarshaler(v)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		e.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.Write(strconv.AppendInt(e.scratch[:0], v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.Write(strconv.AppendUint(e.scratch[:0], v.Uint(), 10))
+	case reflect.Float32:
+		return e.encodeFloat(v, 32)
+	case reflect.Float64:
+		return e.encodeFloat(v, 64)
+	case reflect.String:
+		if t == numberType {
+			return e.encodeNumber(v.String())
+		}
+		e.Write(appendString(e.scratch[:0], v.String(), e.escapeHTML))
+	case reflect.Interface:
+		if v.IsNil() {
+			e.WriteString("null")
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			e.WriteString("null")
+			return nil
+		}
+		leave, err := e.enter(v, cycleKey{ptr: v.Pointer(), typ: t})
+		if err != nil {
+			return err
+		}
+		defer leave()
+		e.bytesTag = bytesTag
+		return e.encode(v.Elem())
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	case reflect.Map:
+		return e.encodeMap(v)
+	case reflect.Slice:
+		return e.encodeSlice(v, bytesTag)
+	case reflect.Array:
+		return e.encodeArray(v)
+	default:
+		return &json.UnsupportedTypeError{Type: t}
+	}
+	return nil
+}
+
+// encodeNumber writes the json.Number s as a number literal, 0 when it's empty.
+func (e *encodeState) encodeNumber(s string) error {
+	if s == "" {
+		s = "0"
+	}
+	if !isValidNumber(s) {
+		return fmt.Errorf("json: invalid number literal %q", s)
+	}
+	e.WriteString(s)
+	return nil
+}
+
+// isValidNumber reports whether s is a valid JSON number literal.
+func isValidNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	// Optional -
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+
+	// Digits
+	switch {
+	default:
+		return false
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		s = s[1:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// . followed by 1 or more digits.
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// e or E followed by an optional - or + and
+	// 1 or more digits.
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// Make sure we are at the end.
+	return s == ""
+}
+
+func (e *encodeState) encodeMarshaler(v reflect.Value) error {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		e.WriteString("null")
+		return nil
+	}
+	b, err := v.Interface().(json.Marshaler).MarshalJSON()
+	if err != nil {
+		return &json.MarshalerError{Type: v.Type(), Err: err}
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, b); err != nil {
+		return &json.MarshalerError{Type: v.Type(), Err: err}
+	}
+	if e.escapeHTML {
+		json.HTMLEscape(&e.Buffer, compact.Bytes())
+	} else {
+		e.Write(compact.Bytes())
+	}
+	return nil
+}
+
+func (e *encodeState) encodeTextMarshaler(v reflect.Value) error {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		e.WriteString("null")
+		return nil
+	}
+	b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return &json.MarshalerError{Type: v.Type(), Err: err}
+	}
+	e.Write(appendString(e.scratch[:0], string(b), e.escapeHTML))
+	return nil
+}
+
+func (e *encodeState) encodeFloat(v reflect.Value, bits int) error {
+	f := v.Float()
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+
+	// Convert as if by ES6 number to string conversion,
+	// the same way encoding/json does.
+	b := e.scratch[:0]
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	e.Write(b)
+	return nil
+}
+
+func (e *encodeState) encodeStruct(v reflect.Value) error {
+	e.WriteByte('{')
+	first := true
+
+fields:
+	for _, f := range cachedEncFields(v.Type()) {
+		fv := v
+		for _, i := range f.index {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					// The field is promoted through a nil embedded pointer.
+					continue fields
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(i)
+		}
+
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		if !first {
+			e.WriteByte(',')
+		}
+		first = false
+		if e.escapeHTML {
+			e.Write(f.nameHTML)
+		} else {
+			e.Write(f.nameJSON)
+		}
+
+		if f.quoted {
+			if err := e.encodeQuoted(fv); err != nil {
+				return err
+			}
+			continue
+		}
+		e.bytesTag = f.bytes
+		if err := e.encode(fv); err != nil {
+			return err
+		}
+	}
+
+	e.WriteByte('}')
+	return nil
+}
+
+// encodeQuoted writes a value of a field tagged with the string option.
+func (e *encodeState) encodeQuoted(v reflect.Value) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			e.WriteString("null")
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	var inner encodeState
+	inner.escapeHTML = e.escapeHTML
+	if err := inner.encode(v); err != nil {
+		return err
+	}
+	if v.Kind() == reflect.String {
+		e.Write(appendString(e.scratch[:0], inner.String(), e.escapeHTML))
+		return nil
+	}
+	e.WriteByte('"')
+	e.Write(inner.Bytes())
+	e.WriteByte('"')
+	return nil
+}
+
+func (e *encodeState) encodeMap(v reflect.Value) error {
+	t := v.Type()
+	switch t.Key().Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !t.Key().Implements(textMarshalerType) {
+			return &json.UnsupportedTypeError{Type: t}
+		}
+	}
+
+	if v.IsNil() || v.Len() == 0 {
+		e.WriteString("{}")
+		return nil
+	}
+
+	leave, err := e.enter(v, cycleKey{ptr: v.Pointer(), typ: t})
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	type entry struct {
+		key string
+		val reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := resolveKeyName(iter.Key())
+		if err != nil {
+			return &json.MarshalerError{Type: t.Key(), Err: err}
+		}
+		entries = append(entries, entry{key: key, val: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	e.WriteByte('{')
+	for i, kv := range entries {
+		if i > 0 {
+			e.WriteByte(',')
+		}
+		e.Write(appendString(e.scratch[:0], kv.key, e.escapeHTML))
+		e.WriteByte(':')
+		if err := e.encode(kv.val); err != nil {
+			return err
+		}
+	}
+	e.WriteByte('}')
+	return nil
+}
+
+// resolveKeyName returns the JSON object key for the map key k.
+func resolveKeyName(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	panic("niltoempty: unexpected map key type")
+}
+
+// encodeSlice writes the slice v, held by a field with the bytes option of the
+// niltoempty tag when bytesTag is set.
+func (e *encodeState) encodeSlice(v reflect.Value, bytesTag bool) error {
+	t := v.Type()
+	if isByteSlice(t) {
+		// Byte slices are encoded as base64 strings, an empty one for nil
+		// unless the policy leaves it nil.
+		if v.IsNil() && !e.emptyBytes(bytesTag) {
+			e.WriteString("null")
+			return nil
+		}
+		b := v.Bytes()
+		e.WriteByte('"')
+		enc := base64.NewEncoder(base64.StdEncoding, &e.Buffer)
+		enc.Write(b)
+		enc.Close()
+		e.WriteByte('"')
+		return nil
+	}
+
+	if v.IsNil() || v.Len() == 0 {
+		e.WriteString("[]")
+		return nil
+	}
+
+	// The length is part of the key, as slices of different lengths
+	// may share the same backing array without forming a cycle.
+	leave, err := e.enter(v, cycleKey{ptr: v.Pointer(), typ: t, len: v.Len()})
+	if err != nil {
+		return err
+	}
+	defer leave()
+	return e.encodeArray(v)
+}
+
+// emptyBytes reports whether a nil byte slice is written as an empty one,
+// given whether it's held by a field with the bytes option.
+func (e *encodeState) emptyBytes(bytesTag bool) bool {
+	switch e.bytes {
+	case BytesNil:
+		return false
+	case BytesTagged:
+		return bytesTag
+	}
+	return true
+}
+
+// isByteSlice reports whether t is a slice of bytes encoded as base64, i.e.
+// its element type doesn't marshal itself.
+func isByteSlice(t reflect.Type) bool {
+	if t.Elem().Kind() != reflect.Uint8 {
+		return false
+	}
+	p := reflect.PointerTo(t.Elem())
+	return !p.Implements(marshalerType) && !p.Implements(textMarshalerType)
+}
+
+func (e *encodeState) encodeArray(v reflect.Value) error {
+	e.WriteByte('[')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			e.WriteByte(',')
+		}
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	e.WriteByte(']')
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+const hex = "0123456789abcdef"
+
+// appendString appends s as a quoted JSON string, escaped the same way
+// encoding/json does it.
+func appendString(dst []byte, s string, escapeHTML bool) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && (!escapeHTML || b != '<' && b != '>' && b != '&') {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				// This encodes bytes < 0x20 except for \b, \f, \n, \r and \t,
+				// and <, > and & when escaping HTML.
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 is coerced into the replacement character.
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 is LINE SEPARATOR and U+2029 is PARAGRAPH SEPARATOR.
+		// They are valid JSON but break JSONP, so they are escaped as well.
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	dst = append(dst, '"')
+	return dst
+}
@@ -0,0 +1,320 @@
+package niltoempty_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	encEmbedded struct {
+		E     string `json:"e"`
+		Inner []int  `json:"inner"`
+	}
+	encHidden struct {
+		H string
+	}
+	encConflictA struct {
+		X int
+	}
+	encConflictB struct {
+		X int
+	}
+	encValueMarshaler struct {
+		V string
+	}
+	encPtrMarshaler struct {
+		V string
+	}
+	encText string
+	encKey  struct {
+		A, B int
+	}
+)
+
+func (m encValueMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{ "value" : "` + m.V + `" }`), nil
+}
+
+func (m *encPtrMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"ptr:` + m.V + `"`), nil
+}
+
+func (k encKey) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(k.A) + "-" + strconv.Itoa(k.B)), nil
+}
+
+func (t encText) MarshalText() ([]byte, error) {
+	return []byte("text:" + string(t)), nil
+}
+
+type encAll struct {
+	Bool      bool    `json:"bool"`
+	Int       int     `json:"int"`
+	Int8      int8    `json:"int8"`
+	Uint      uint64  `json:"uint"`
+	Float32   float32 `json:"float32"`
+	Float64   float64 `json:"float64"`
+	Small     float64 `json:"small"`
+	Big       float64 `json:"big"`
+	String    string  `json:"string"`
+	HTML      string  `json:"html"`
+	Control   string  `json:"control"`
+	Quoted    int     `json:"quoted,string"`
+	QuotedStr string  `json:"quoted_str,string"`
+	QuotedPtr *int    `json:",string"`
+	Omitted   string  `json:"omitted,omitempty"`
+	OmitSlice []int   `json:"omit_slice,omitempty"`
+	Ignored   string  `json:"-"`
+	Dash      string  `json:"-,"`
+	NoTag     string
+	Bytes     []byte              `json:"bytes"`
+	Array     [2]int              `json:"array"`
+	Slice     []string            `json:"slice"`
+	Map       map[string]int      `json:"map"`
+	IntMap    map[int]string      `json:"int_map"`
+	TextMap   map[encKey]int      `json:"text_map"`
+	Ptr       *encHidden          `json:"ptr"`
+	NilPtr    *encHidden          `json:"nil_ptr"`
+	Iface     any                 `json:"iface"`
+	NilIface  any                 `json:"nil_iface"`
+	Value     encValueMarshaler   `json:"value"`
+	PtrM      encPtrMarshaler     `json:"ptr_m"`
+	PtrMPtr   *encPtrMarshaler    `json:"ptr_m_ptr"`
+	Text      encText             `json:"text"`
+	IP        net.IP              `json:"ip"`
+	Time      time.Time           `json:"time"`
+	Raw       json.RawMessage     `json:"raw"`
+	Number    json.Number         `json:"number"`
+	ZeroNum   json.Number         `json:"zero_num"`
+	QuotedNum json.Number         `json:"quoted_num,string"`
+	Numbers   map[string]any      `json:"numbers"`
+	Nested    map[string][]encAll `json:"nested"`
+	Marshals  []encValueMarshaler `json:"marshals"`
+	PtrSlice  []*encPtrMarshaler  `json:"ptr_slice"`
+	Texts     map[string]encText  `json:"texts"`
+	unexp     string
+	encEmbedded
+	*encHidden
+	encConflictA
+	encConflictB
+}
+
+func newEncAll() encAll {
+	n := 42
+	return encAll{
+		Bool:      true,
+		Int:       -1,
+		Int8:      8,
+		Uint:      math.MaxUint64,
+		Float32:   3.14,
+		Float64:   1.5,
+		Small:     1e-7,
+		Big:       1e21,
+		String:    "hello \"world\"\\",
+		HTML:      "<a href='x'>&</a>",
+		Control:   "\b\f\n\r\t\x01   ",
+		Quoted:    7,
+		QuotedStr: "q",
+		QuotedPtr: &n,
+		Ignored:   "ignored",
+		Dash:      "dash",
+		NoTag:     "notag",
+		Bytes:     []byte("bytes"),
+		Array:     [2]int{1, 2},
+		Slice:     []string{"a", "b"},
+		Map:       map[string]int{"z": 1, "a": 2},
+		IntMap:    map[int]string{10: "ten", 2: "two"},
+		TextMap:   map[encKey]int{{1, 2}: 1, {0, 5}: 2},
+		Ptr:       &encHidden{H: "h"},
+		Iface:     map[string]any{"x": []any{1.5, "y", true}},
+		Value:     encValueMarshaler{V: "v"},
+		PtrM:      encPtrMarshaler{V: "addr"},
+		PtrMPtr:   &encPtrMarshaler{V: "p"},
+		Text:      "t",
+		IP:        net.IPv4(127, 0, 0, 1),
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Raw:       json.RawMessage(`{ "raw" : [1, 2] }`),
+		Number:    "12.5e3",
+		QuotedNum: "-7",
+		Numbers:   map[string]any{"n": json.Number("1")},
+		Nested:    map[string][]encAll{},
+		Marshals:  []encValueMarshaler{{V: "a"}},
+		PtrSlice:  []*encPtrMarshaler{{V: "s"}, nil},
+		Texts:     map[string]encText{"a": "b"},
+		unexp:     "unexported",
+		encEmbedded: encEmbedded{
+			E:     "embedded",
+			Inner: []int{1},
+		},
+		encHidden:    &encHidden{H: "promoted"},
+		encConflictA: encConflictA{X: 1},
+		encConflictB: encConflictB{X: 2},
+	}
+}
+
+func encode(t *testing.T, v any, configure ...func(*niltoempty.Encoder)) string {
+	t.Helper()
+	var b bytes.Buffer
+	enc := niltoempty.NewEncoder(&b)
+	for _, c := range configure {
+		c(enc)
+	}
+	require.NoError(t, enc.Encode(v))
+	return b.String()
+}
+
+func TestEncoderMatchesEncodingJSON(t *testing.T) {
+	v := newEncAll()
+	nested := newEncAll()
+	v.Nested["n"] = []encAll{nested}
+
+	for _, tt := range []struct {
+		name       string
+		escapeHTML bool
+		prefix     string
+		indent     string
+	}{
+		{name: "default", escapeHTML: true},
+		{name: "no HTML escaping"},
+		{name: "indent", escapeHTML: true, prefix: ">", indent: "  "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var want bytes.Buffer
+			jsonEnc := json.NewEncoder(&want)
+			jsonEnc.SetEscapeHTML(tt.escapeHTML)
+			jsonEnc.SetIndent(tt.prefix, tt.indent)
+			require.NoError(t, jsonEnc.Encode(&v))
+
+			got := encode(t, &v, func(enc *niltoempty.Encoder) {
+				enc.SetEscapeHTML(tt.escapeHTML)
+				enc.SetIndent(tt.prefix, tt.indent)
+			})
+			assert.Equal(t, want.String(), got)
+		})
+	}
+
+	t.Run("by value", func(t *testing.T) {
+		want, err := json.Marshal(v)
+		require.NoError(t, err)
+		assert.Equal(t, string(want)+"\n", encode(t, v))
+	})
+}
+
+func TestEncoderNils(t *testing.T) {
+	type S struct {
+		S   []int           `json:"s"`
+		M   map[string]int  `json:"m"`
+		PS  *[]int          `json:"ps"`
+		PM  *map[string]int `json:"pm"`
+		O   []int           `json:"o,omitempty"`
+		B   []byte          `json:"b"`
+		I   any             `json:"i"`
+		Raw json.RawMessage `json:"raw"`
+		IP  net.IP          `json:"ip"`
+	}
+
+	assert.Equal(t, `{"s":[],"m":{},"ps":null,"pm":null,"b":"","i":null,"raw":null,"ip":""}`+"\n", encode(t, S{}))
+	assert.Equal(t, "[]\n", encode(t, []int(nil)))
+	assert.Equal(t, "{}\n", encode(t, map[string]any(nil)))
+	assert.Equal(t, "null\n", encode(t, nil))
+	assert.Equal(t, `[[],{},null]`+"\n", encode(t, []any{[]int(nil), map[int]int(nil), nil}))
+	assert.Equal(t, `{"a":[]}`+"\n", encode(t, map[string][]int{"a": nil}))
+	assert.Equal(t, "[[],[]]\n", encode(t, [2][]int{}))
+
+	var v S
+	encode(t, &v)
+	assert.Nil(t, v.S, "input is not modified")
+}
+
+func TestEncoderBytes(t *testing.T) {
+	type S struct {
+		B      []byte  `json:"b"`
+		Tagged []byte  `json:"tagged" niltoempty:"bytes"`
+		Ptr    *[]byte `json:"ptr" niltoempty:"bytes"`
+		Set    []byte  `json:"set"`
+	}
+	v := S{Ptr: new([]byte), Set: []byte("a")}
+
+	encodeBytes := func(policy niltoempty.BytesPolicy) string {
+		return encode(t, v, func(enc *niltoempty.Encoder) { enc.SetBytes(policy) })
+	}
+
+	assert.Equal(t, `{"b":"","tagged":"","ptr":"","set":"YQ=="}`+"\n", encodeBytes(niltoempty.BytesEmpty))
+	assert.Equal(t, `{"b":null,"tagged":null,"ptr":null,"set":"YQ=="}`+"\n", encodeBytes(niltoempty.BytesNil))
+	assert.Equal(t, `{"b":null,"tagged":"","ptr":"","set":"YQ=="}`+"\n", encodeBytes(niltoempty.BytesTagged))
+
+	// The same as Initialize with WithBytes would produce.
+	for _, policy := range []niltoempty.BytesPolicy{niltoempty.BytesEmpty, niltoempty.BytesNil, niltoempty.BytesTagged} {
+		c := v
+		p := *v.Ptr
+		c.Ptr = &p
+		niltoempty.InitializeWith(&c, niltoempty.WithBytes(policy))
+		want, err := json.Marshal(c)
+		require.NoError(t, err)
+		assert.Equal(t, string(want)+"\n", encodeBytes(policy))
+	}
+}
+
+func TestEncoderInvalidUTF8(t *testing.T) {
+	var s string
+	require.NoError(t, json.Unmarshal([]byte(encode(t, "a\xffb")), &s))
+	assert.Equal(t, "a\ufffdb", s)
+}
+
+func TestEncoderErrors(t *testing.T) {
+	encodeErr := func(v any) error {
+		return niltoempty.NewEncoder(&bytes.Buffer{}).Encode(v)
+	}
+
+	var unsupportedType *json.UnsupportedTypeError
+	assert.ErrorAs(t, encodeErr(make(chan int)), &unsupportedType)
+	assert.ErrorAs(t, encodeErr(map[[2]int]int{{1, 2}: 3}), &unsupportedType)
+
+	assert.EqualError(t, encodeErr(json.Number("1x")), `json: invalid number literal "1x"`)
+
+	var unsupportedValue *json.UnsupportedValueError
+	assert.ErrorAs(t, encodeErr(math.NaN()), &unsupportedValue)
+	assert.ErrorAs(t, encodeErr(math.Inf(1)), &unsupportedValue)
+
+	type C struct {
+		P *C `json:"p"`
+	}
+	c := &C{}
+	c.P = c
+	assert.ErrorAs(t, encodeErr(c), &unsupportedValue)
+	assert.Contains(t, encodeErr(c).Error(), "encountered a cycle")
+
+	var marshalerErr *json.MarshalerError
+	assert.ErrorAs(t, encodeErr(json.RawMessage(`{`)), &marshalerErr)
+	assert.ErrorAs(t, encodeErr(failingMarshaler{}), &marshalerErr)
+	assert.True(t, errors.Is(encodeErr(failingMarshaler{}), errFailingMarshaler))
+}
+
+var errFailingMarshaler = errors.New("failing marshaler")
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalJSON() ([]byte, error) {
+	return nil, errFailingMarshaler
+}
+
+func TestEncoderStream(t *testing.T) {
+	var b bytes.Buffer
+	enc := niltoempty.NewEncoder(&b)
+	require.NoError(t, enc.Encode(T{}))
+	require.NoError(t, enc.Encode([]string(nil)))
+
+	lines := strings.Split(b.String(), "\n")
+	assert.Equal(t, []string{`{"m":{},"s":[]}`, `[]`, ``}, lines)
+}
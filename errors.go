@@ -0,0 +1,83 @@
+package niltoempty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrNotPointer is returned when the object passed for initialization is not a pointer.
+	ErrNotPointer = errors.New("niltoempty: expected pointer")
+
+	// ErrNilPointer is returned when the object passed for initialization is a nil pointer.
+	ErrNilPointer = errors.New("niltoempty: nil pointer")
+
+	// ErrUnsettable is reported for a nil map or slice in an exported field
+	// which can't be replaced, e.g. because it was reached through an unexported
+	// pointer field.
+	ErrUnsettable = errors.New("niltoempty: value cannot be set")
+
+	// ErrMaxDepth is reported when values nested deeper than allowed by
+	// WithMaxDepth were left untouched.
+	ErrMaxDepth = errors.New("niltoempty: maximum depth exceeded")
+
+	// ErrMaxNodes is reported when the traversal was stopped after visiting
+	// the number of values allowed by WithMaxNodes.
+	ErrMaxNodes = errors.New("niltoempty: maximum number of values exceeded")
+)
+
+// PathError records an error together with the path of the value which caused it.
+type PathError struct {
+	// Path leads from the root object to the offending value, e.g. `.Orders[3].Items`.
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Err.Error() + " at " + e.Path
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// InitializeE works like InitializeWith but reports problems as errors instead of panicking.
+//
+// It returns ErrNotPointer or ErrNilPointer when obj is not a non-nil pointer.
+// Nil maps and slices which could not be replaced are reported as *PathError
+// wrapping ErrUnsettable; the rest of obj is still initialized in that case.
+// Exceeding the limits set by WithMaxDepth and WithMaxNodes is reported as
+// *PathError wrapping ErrMaxDepth or ErrMaxNodes, which take precedence over
+// ErrUnsettable. ErrMaxNodes, like the error of the context passed to
+// InitializeContext, takes precedence over both, as the traversal stopped.
+// A panic raised during the traversal is recovered and returned as *PathError
+// holding the path where it occurred.
+func InitializeE(obj interface{}, opts ...Option) error {
+	return initializeE(nil, obj, opts)
+}
+
+// initializeE implements InitializeE, checking ctx during the traversal when
+// it's not nil.
+func initializeE(ctx context.Context, obj interface{}, opts []Option) (err error) {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr {
+		return ErrNotPointer
+	}
+	if v.IsNil() {
+		return ErrNilPointer
+	}
+
+	w := newWalker(opts)
+	w.ctx = ctx
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PathError{Path: w.path.String(), Err: fmt.Errorf("niltoempty: panic: %v", r)}
+		}
+	}()
+
+	w.initializeRoot(v)
+
+	return w.err
+}
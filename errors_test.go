@@ -0,0 +1,193 @@
+package niltoempty_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializeE(t *testing.T) {
+	t.Run("pointer", func(t *testing.T) {
+		var v T
+
+		require.NoError(t, niltoempty.InitializeE(&v))
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		assert.Equal(t, `{"m":{},"s":[]}`, string(b))
+	})
+
+	t.Run("not a pointer", func(t *testing.T) {
+		var v T
+
+		assert.ErrorIs(t, niltoempty.InitializeE(v), niltoempty.ErrNotPointer)
+		assert.ErrorIs(t, niltoempty.InitializeE(nil), niltoempty.ErrNotPointer)
+		assert.ErrorIs(t, niltoempty.InitializeE([]any(nil)), niltoempty.ErrNotPointer)
+	})
+
+	t.Run("nil pointer", func(t *testing.T) {
+		assert.ErrorIs(t, niltoempty.InitializeE((*T)(nil)), niltoempty.ErrNilPointer)
+	})
+
+	t.Run("time is not reported", func(t *testing.T) {
+		v := struct {
+			At time.Time
+			S  []int
+		}{At: time.Now().In(time.FixedZone("UTC+2", 2*60*60))}
+
+		require.NoError(t, niltoempty.InitializeE(&v))
+		assert.NotNil(t, v.S)
+	})
+}
+
+func TestInitializeEUnsettable(t *testing.T) {
+	type Inner struct {
+		Exported   []int
+		unexported []int
+		M          map[string][]int
+		I          any
+	}
+	type Outer struct {
+		S     []int
+		inner *Inner
+	}
+
+	t.Run("exported field behind unexported pointer", func(t *testing.T) {
+		v := Outer{inner: &Inner{
+			M: map[string][]int{},
+			I: 1,
+		}}
+
+		err := niltoempty.InitializeE(&v)
+		require.ErrorIs(t, err, niltoempty.ErrUnsettable)
+
+		var pathErr *niltoempty.PathError
+		require.True(t, errors.As(err, &pathErr))
+		assert.Equal(t, ".inner.Exported", pathErr.Path)
+		assert.Equal(t, "niltoempty: value cannot be set at .inner.Exported", err.Error())
+
+		// The rest of the object is still initialized.
+		assert.NotNil(t, v.S)
+	})
+
+	t.Run("map value behind unexported pointer", func(t *testing.T) {
+		v := Outer{inner: &Inner{
+			Exported: []int{},
+			M:        map[string][]int{"a": nil},
+			I:        1,
+		}}
+
+		var pathErr *niltoempty.PathError
+		require.True(t, errors.As(niltoempty.InitializeE(&v), &pathErr))
+		assert.Equal(t, `.inner.M["a"]`, pathErr.Path)
+		assert.Nil(t, v.inner.M["a"])
+	})
+
+	t.Run("interface behind unexported pointer", func(t *testing.T) {
+		v := Outer{inner: &Inner{
+			Exported: []int{},
+			M:        map[string][]int{},
+			I:        []int(nil),
+		}}
+
+		var pathErr *niltoempty.PathError
+		require.True(t, errors.As(niltoempty.InitializeE(&v), &pathErr))
+		assert.Equal(t, ".inner.I", pathErr.Path)
+	})
+
+	t.Run("unexported fields are not reported", func(t *testing.T) {
+		v := Outer{inner: &Inner{
+			Exported: []int{},
+			M:        map[string][]int{},
+		}}
+
+		assert.NoError(t, niltoempty.InitializeE(&v))
+	})
+}
+
+func TestInitializeELimits(t *testing.T) {
+	type Node struct {
+		Items    []int
+		Children []Node
+	}
+	newTree := func() Node {
+		return Node{Children: []Node{{Children: []Node{{}}}, {}}}
+	}
+
+	t.Run("max depth", func(t *testing.T) {
+		v := newTree()
+		err := niltoempty.InitializeE(&v, niltoempty.WithMaxDepth(3))
+		require.ErrorIs(t, err, niltoempty.ErrMaxDepth)
+
+		var pathErr *niltoempty.PathError
+		require.ErrorAs(t, err, &pathErr)
+		assert.Equal(t, ".Children[0].Children[0]", pathErr.Path)
+
+		// Everything up to the limit is still initialized.
+		assert.Equal(t, []int{}, v.Children[1].Items)
+		assert.Nil(t, v.Children[0].Children[0].Items)
+	})
+
+	t.Run("within depth", func(t *testing.T) {
+		v := newTree()
+		require.NoError(t, niltoempty.InitializeE(&v, niltoempty.WithMaxDepth(5)))
+	})
+
+	t.Run("max nodes", func(t *testing.T) {
+		v := newTree()
+		err := niltoempty.InitializeE(&v, niltoempty.WithMaxNodes(6))
+		require.ErrorIs(t, err, niltoempty.ErrMaxNodes)
+
+		var pathErr *niltoempty.PathError
+		require.ErrorAs(t, err, &pathErr)
+		assert.Equal(t, ".Children[0].Children[0]", pathErr.Path)
+
+		// The traversal stopped there.
+		assert.Equal(t, []int{}, v.Items)
+		assert.Equal(t, []int{}, v.Children[0].Items)
+		assert.Nil(t, v.Children[1].Items)
+	})
+
+	t.Run("within nodes", func(t *testing.T) {
+		v := newTree()
+		require.NoError(t, niltoempty.InitializeE(&v, niltoempty.WithMaxNodes(100)))
+	})
+
+	t.Run("precedence over unsettable", func(t *testing.T) {
+		v := struct {
+			hidden *struct{ S []int }
+			Node   Node
+		}{hidden: &struct{ S []int }{}, Node: newTree()}
+
+		err := niltoempty.InitializeE(&v, niltoempty.WithMaxDepth(2))
+		assert.ErrorIs(t, err, niltoempty.ErrMaxDepth)
+		assert.NotErrorIs(t, err, niltoempty.ErrUnsettable)
+	})
+
+	t.Run("both limits", func(t *testing.T) {
+		v := make([]Node, 100)
+		v[0] = newTree()
+
+		// The depth is exceeded first, but stopping matters more.
+		err := niltoempty.InitializeE(&v, niltoempty.WithMaxDepth(2), niltoempty.WithMaxNodes(30))
+		assert.ErrorIs(t, err, niltoempty.ErrMaxNodes)
+		assert.NotErrorIs(t, err, niltoempty.ErrMaxDepth)
+		assert.Nil(t, v[len(v)-1].Items)
+
+		v = make([]Node, 100)
+		v[0] = newTree()
+		err = niltoempty.InitializeE(&v, niltoempty.WithMaxDepth(2), niltoempty.WithMaxNodes(1000))
+		assert.ErrorIs(t, err, niltoempty.ErrMaxDepth)
+		assert.Equal(t, []int{}, v[len(v)-1].Items)
+	})
+
+	t.Run("not reported by Clone", func(t *testing.T) {
+		v := newTree()
+		assert.NotPanics(t, func() { niltoempty.Clone(v, niltoempty.WithMaxDepth(1)) })
+		assert.Panics(t, func() { niltoempty.Clone(v, niltoempty.WithMaxNodes(1)) })
+	})
+}
@@ -0,0 +1,37 @@
+package niltoempty
+
+import (
+	"reflect"
+)
+
+// Find returns the paths of all nil maps and slices which InitializeWith,
+// called with the same opts, would replace. Nothing is modified.
+//
+// Unlike InitializeWith, Find also accepts values which are not pointers.
+// Values which couldn't be replaced, like those reached through unexported
+// pointer fields, are not reported.
+func Find(obj interface{}, opts ...Option) []Path {
+	v := reflect.ValueOf(obj)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() != reflect.Ptr {
+		// Make an addressable copy, so the values are reported as they
+		// would be when a pointer was passed.
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	}
+
+	w := newWalker(opts)
+	w.readOnly = true
+	w.initializeRoot(v)
+
+	return w.found
+}
+
+// HasNil reports whether obj holds any nil map or slice which InitializeWith,
+// called with the same opts, would replace. See Find for details.
+func HasNil(obj interface{}, opts ...Option) bool {
+	return len(Find(obj, opts...)) > 0
+}
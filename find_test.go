@@ -0,0 +1,88 @@
+package niltoempty_test
+
+import (
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFind(t *testing.T) {
+	type (
+		Order struct {
+			Items []string
+		}
+		Resp struct {
+			Orders  []Order
+			Meta    map[string]any
+			ByID    map[int]Order
+			Any     any
+			Ptr     *Order
+			NilPtr  *[]int
+			private []int
+		}
+	)
+	newResp := func() Resp {
+		return Resp{
+			Orders: []Order{{Items: []string{}}, {}},
+			Meta:   map[string]any{"tags": []string(nil), "name": "x", "none": nil},
+			ByID:   map[int]Order{7: {}},
+			Any:    Order{},
+			Ptr:    &Order{},
+		}
+	}
+
+	t.Run("paths", func(t *testing.T) {
+		v := newResp()
+
+		assert.ElementsMatch(t, []niltoempty.Path{
+			".Orders[1].Items",
+			`.Meta["tags"]`,
+			".ByID[7].Items",
+			".Any.Items",
+			".Ptr.Items",
+		}, niltoempty.Find(&v))
+		assert.True(t, niltoempty.HasNil(&v))
+	})
+
+	t.Run("nothing is modified", func(t *testing.T) {
+		v := newResp()
+		niltoempty.Find(&v)
+
+		assert.Equal(t, newResp(), v)
+		assert.Nil(t, v.Orders[1].Items)
+		assert.Nil(t, v.Meta["tags"])
+		assert.Nil(t, v.ByID[7].Items)
+		assert.Nil(t, v.Any.(Order).Items)
+		assert.Nil(t, v.Ptr.Items)
+	})
+
+	t.Run("by value", func(t *testing.T) {
+		assert.Equal(t, []niltoempty.Path{".Items"}, niltoempty.Find(Order{}))
+	})
+
+	t.Run("root", func(t *testing.T) {
+		assert.Equal(t, []niltoempty.Path{"."}, niltoempty.Find([]int(nil)))
+		assert.Equal(t, []niltoempty.Path{"[0]", "[1]"}, niltoempty.Find([][]int{nil, nil}))
+		assert.Empty(t, niltoempty.Find(nil))
+		assert.Empty(t, niltoempty.Find((*Order)(nil)))
+	})
+
+	t.Run("no nils", func(t *testing.T) {
+		v := Order{Items: []string{}}
+
+		assert.Empty(t, niltoempty.Find(&v))
+		assert.False(t, niltoempty.HasNil(&v))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		v := newResp()
+
+		assert.ElementsMatch(t, []niltoempty.Path{
+			`.Meta["tags"]`,
+			".Any.Items",
+			".Ptr.Items",
+		}, niltoempty.Find(&v, niltoempty.WithMaxDepth(2)))
+		assert.False(t, niltoempty.HasNil(&v, niltoempty.WithSlices(false)))
+	})
+}
@@ -0,0 +1,126 @@
+package niltoempty
+
+import (
+	"reflect"
+)
+
+// Initializer is implemented by types which replace their nil maps and slices
+// themselves, e.g. types holding unexported maps or with InitializeNils methods
+// generated by niltoempty-gen.
+//
+// When Initialize reaches a value implementing Initializer, it calls
+// InitializeNils instead of traversing the value through reflection. A method
+// with a pointer receiver is called when the value can be set, e.g. it's held
+// in an exported field or in a slice. InitializeReport reports such a value as
+// changed, as it can't tell what the method did. Find and EmptyToNil still use
+// reflection, as they do something else than InitializeNils does.
+//
+// InitializeNils knows nothing about the options, limits and context of the
+// traversal, nor about the values already visited. So the method is called
+// only by traversals with the default options, apart from WithRegistry, and
+// without a context, and only for types whose values can't be part of cycles:
+// types which can't lead back to themselves through pointers, slices and maps,
+// and can't reach interfaces. Other values are traversed through reflection.
+type Initializer interface {
+	InitializeNils()
+}
+
+// Skipper is implemented by types which opt out of the traversal. When SkipNils
+// returns true, the value and everything reachable through it is left untouched.
+//
+// The rules for the receivers are the same as for Initializer.
+type Skipper interface {
+	SkipNils() bool
+}
+
+var (
+	initializerType = reflect.TypeOf((*Initializer)(nil)).Elem()
+	skipperType     = reflect.TypeOf((*Skipper)(nil)).Elem()
+)
+
+// receiver tells how the method of an interface implemented by a type is called.
+type receiver uint8
+
+const (
+	noReceiver receiver = iota
+	valueReceiver
+	pointerReceiver
+)
+
+// receiverOf returns how t implements iface. Pointers and interfaces are
+// followed by the traversal, so their methods are reached through the values
+// they refer to.
+func receiverOf(t, iface reflect.Type) receiver {
+	switch {
+	case t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface:
+		return noReceiver
+	case t.Implements(iface):
+		return valueReceiver
+	case reflect.PointerTo(t).Implements(iface):
+		return pointerReceiver
+	}
+	return noReceiver
+}
+
+// methodsOf returns v, or the pointer to v, as an interface value to call the
+// methods with receiver r on. It reports false when they can't be called.
+func methodsOf(v reflect.Value, r receiver) (interface{}, bool) {
+	switch r {
+	case valueReceiver:
+		if v.CanInterface() {
+			return v.Interface(), true
+		}
+	case pointerReceiver:
+		if v.CanSet() {
+			return v.Addr().Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// callHooks lets the function registered for v's type or v itself take over
+// the traversal of v. It reports whether v was handled.
+func (w *walker) callHooks(v reflect.Value) bool {
+	initializing := !w.readOnly && !w.emptyToNil && !w.opts.noHooks
+
+	t := v.Type()
+	for _, h := range w.handlers {
+		if fn, ok := h[t]; ok {
+			if !initializing || !v.CanSet() {
+				break
+			}
+			fn(v)
+			w.handedOver(v)
+			return true
+		}
+	}
+
+	// Only named types have methods; this spares a plan lookup for the
+	// most common values.
+	if t.Name() == "" {
+		return false
+	}
+	p := w.registry.planFor(t)
+
+	if s, ok := methodsOf(v, p.skipper); ok && s.(Skipper).SkipNils() {
+		return true
+	}
+
+	if !initializing || !w.defaults || w.ctx != nil || !p.acyclic {
+		return false
+	}
+	if i, ok := methodsOf(v, p.initializer); ok {
+		i.(Initializer).InitializeNils()
+		w.handedOver(v)
+		return true
+	}
+	return false
+}
+
+// handedOver records v, initialized by a hook, as changed, as it may have been.
+func (w *walker) handedOver(v reflect.Value) {
+	w.changes++
+	if w.report != nil {
+		w.report.add(Path(w.path.String()), v.Type())
+	}
+}
@@ -0,0 +1,237 @@
+package niltoempty_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfInitialized counts the calls of its InitializeNils method.
+type selfInitialized struct {
+	Items []int
+	calls int
+}
+
+func (s *selfInitialized) InitializeNils() {
+	s.calls++
+	if s.Items == nil {
+		s.Items = []int{}
+	}
+}
+
+// orderedMap holds an unexported map which only its own method can initialize.
+type orderedMap struct {
+	keys   []string
+	values map[string]int
+}
+
+func (m *orderedMap) InitializeNils() {
+	if m.keys == nil {
+		m.keys = []string{}
+	}
+	if m.values == nil {
+		m.values = map[string]int{}
+	}
+}
+
+// stringSet initializes its elements with a value receiver.
+type stringSet map[string]*selfInitialized
+
+func (s stringSet) InitializeNils() {
+	for _, v := range s {
+		v.InitializeNils()
+	}
+}
+
+// opaque opts out of the traversal unless enabled.
+type opaque struct {
+	Items   []int
+	enabled bool
+}
+
+func (o opaque) SkipNils() bool {
+	return !o.enabled
+}
+
+// opaqueList opts out of the traversal with a pointer receiver.
+type opaqueList []map[string]int
+
+func (*opaqueList) SkipNils() bool {
+	return true
+}
+
+// panicking panics when asked to initialize itself.
+type panicking struct{}
+
+func (*panicking) InitializeNils() {
+	panic("boom")
+}
+
+// chained refers to itself, and its method doesn't stop on cycles.
+type chained struct {
+	Items []int
+	Next  *chained
+	calls int
+}
+
+func (c *chained) InitializeNils() {
+	c.calls++
+	if c.Items == nil {
+		c.Items = []int{}
+	}
+	if c.Next != nil {
+		c.Next.InitializeNils()
+	}
+}
+
+var (
+	_ niltoempty.Initializer = (*chained)(nil)
+	_ niltoempty.Initializer = (*selfInitialized)(nil)
+	_ niltoempty.Initializer = (*orderedMap)(nil)
+	_ niltoempty.Initializer = stringSet(nil)
+	_ niltoempty.Skipper     = opaque{}
+	_ niltoempty.Skipper     = (*opaqueList)(nil)
+)
+
+func TestInitializer(t *testing.T) {
+	type Outer struct {
+		Value  selfInitialized
+		Ptr    *selfInitialized
+		Slice  []selfInitialized
+		ByName map[string]selfInitialized
+		Other  []int
+	}
+
+	t.Run("called instead of reflection", func(t *testing.T) {
+		v := Outer{
+			Ptr:    &selfInitialized{},
+			Slice:  []selfInitialized{{}, {}},
+			ByName: map[string]selfInitialized{"a": {}},
+		}
+		niltoempty.Initialize(&v)
+
+		assert.Equal(t, 1, v.Value.calls)
+		assert.Equal(t, []int{}, v.Value.Items)
+		assert.Equal(t, 1, v.Ptr.calls)
+		assert.Equal(t, 1, v.Slice[0].calls)
+		assert.Equal(t, 1, v.Slice[1].calls)
+		assert.Equal(t, 1, v.ByName["a"].calls)
+		assert.Equal(t, []int{}, v.ByName["a"].Items)
+		assert.Equal(t, []int{}, v.Other)
+	})
+
+	t.Run("root", func(t *testing.T) {
+		v := selfInitialized{}
+		niltoempty.Initialize(&v)
+
+		assert.Equal(t, 1, v.calls)
+		assert.Equal(t, []int{}, v.Items)
+	})
+
+	t.Run("not called with options", func(t *testing.T) {
+		v := Outer{Ptr: &selfInitialized{}}
+		niltoempty.InitializeWith(&v, niltoempty.WithSlices(false))
+
+		assert.Equal(t, 0, v.Value.calls)
+		assert.Nil(t, v.Value.Items)
+		assert.Equal(t, 0, v.Ptr.calls)
+		assert.Equal(t, map[string]selfInitialized{}, v.ByName)
+	})
+
+	t.Run("not called with context", func(t *testing.T) {
+		v := Outer{Value: selfInitialized{Items: []int{}}}
+		require.NoError(t, niltoempty.InitializeContext(context.Background(), &v))
+
+		assert.Equal(t, 0, v.Value.calls)
+		assert.Equal(t, []int{}, v.Other)
+	})
+
+	t.Run("not called for cyclic types", func(t *testing.T) {
+		v := chained{}
+		v.Next = &v
+		niltoempty.Initialize(&v)
+
+		assert.Equal(t, 0, v.calls)
+		assert.Equal(t, []int{}, v.Items)
+	})
+
+	t.Run("not called by Find", func(t *testing.T) {
+		v := Outer{Ptr: &selfInitialized{}}
+
+		assert.ElementsMatch(t, []niltoempty.Path{".Value.Items", ".Ptr.Items", ".Slice", ".ByName", ".Other"}, niltoempty.Find(&v))
+		assert.Equal(t, 0, v.Value.calls)
+		assert.Equal(t, 0, v.Ptr.calls)
+	})
+}
+
+func TestInitializerUnexported(t *testing.T) {
+	type Outer struct {
+		Ordered orderedMap
+		Set     stringSet
+	}
+
+	v := Outer{Set: stringSet{"a": {}}}
+	niltoempty.Initialize(&v)
+
+	assert.Equal(t, orderedMap{keys: []string{}, values: map[string]int{}}, v.Ordered)
+	assert.Equal(t, 1, v.Set["a"].calls)
+	assert.Equal(t, []int{}, v.Set["a"].Items)
+}
+
+func TestSkipper(t *testing.T) {
+	type Outer struct {
+		Skipped opaque
+		Enabled opaque
+		List    opaqueList
+		Ptr     *opaque
+		Any     any
+	}
+	newOuter := func() Outer {
+		return Outer{
+			Enabled: opaque{enabled: true},
+			List:    opaqueList{nil},
+			Ptr:     &opaque{},
+			Any:     opaque{},
+		}
+	}
+
+	t.Run("Initialize", func(t *testing.T) {
+		v := newOuter()
+		niltoempty.Initialize(&v)
+
+		assert.Nil(t, v.Skipped.Items)
+		assert.Equal(t, []int{}, v.Enabled.Items)
+		assert.Equal(t, opaqueList{nil}, v.List)
+		assert.Nil(t, v.Ptr.Items)
+		assert.Nil(t, v.Any.(opaque).Items)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		v := newOuter()
+		assert.Equal(t, []niltoempty.Path{".Enabled.Items"}, niltoempty.Find(&v))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var v opaqueList
+		niltoempty.Initialize(&v)
+		assert.Nil(t, v)
+	})
+}
+
+func TestInitializerPanic(t *testing.T) {
+	v := struct {
+		Items []panicking
+	}{Items: []panicking{{}, {}}}
+
+	err := niltoempty.InitializeE(&v)
+	require.Error(t, err)
+
+	var pathErr *niltoempty.PathError
+	require.True(t, errors.As(err, &pathErr))
+	assert.Equal(t, ".Items[0]", pathErr.Path)
+	assert.Contains(t, err.Error(), "boom")
+}
@@ -1,6 +1,8 @@
 package niltoempty
 
 import (
+	"context"
+	"errors"
 	"reflect"
 )
 
@@ -12,15 +14,158 @@ import (
 //
 // Because pointer to element is usually used for modeling optional fields
 // nil pointers to the map or slices are left untouched.
+//
+// See InitializeWith and WithAllocPointers for adjusting this behavior.
+//
+// Values implementing Initializer, or of types with functions registered with
+// RegisterType, are handed over to them instead, see Initializer for when.
 func Initialize(obj interface{}) interface{} {
-	v := reflect.ValueOf(obj)
-	if v.Kind() != reflect.Ptr {
-		panic("niltoempty: expected pointer")
+	return InitializeWith(obj)
+}
+
+// InitializeT works like InitializeWith for the value p points to, but the type
+// of p is checked at compile time and p is returned without losing it.
+// A nil p is returned as it is.
+func InitializeT[T any](p *T, opts ...Option) *T {
+	if p != nil {
+		newWalker(opts).initializeRoot(reflect.ValueOf(p))
+	}
+	return p
+}
+
+// Value returns v initialized as if by InitializeWith called with opts.
+//
+// Only v itself is copied: maps, slices and pointers held by v are shared with
+// the caller, so whatever they refer to is initialized in place. Use Clone to
+// leave the original untouched.
+func Value[T any](v T, opts ...Option) T {
+	return *InitializeT(&v, opts...)
+}
+
+// walker holds the state of a single traversal.
+type walker struct {
+	opts    options
+	visited map[refKey]bool
+
+	// allocating holds struct types allocated by the traversal which are
+	// still being processed.
+	allocating map[reflect.Type]bool
+
+	// path leads from the root to the value being processed.
+	path path
+
+	// exportedField is false when the innermost struct field on the path is
+	// unexported.
+	exportedField bool
+
+	// ownPackage is the package whose unexported fields are processed under
+	// WithUnexported, set for the root.
+	ownPackage string
+
+	// err is the first error encountered during the traversal, and stopped
+	// is set when the traversal has to stop because of it.
+	err     error
+	stopped bool
+
+	// nodes counts the values visited, and changes the values modified,
+	// which may include the ones modified by registered functions and
+	// Initializer methods.
+	nodes   int
+	changes int
+
+	// ctx, when set, is checked every ctxCheckInterval values.
+	ctx context.Context
+
+	// defaults is set when the options are the default ones, so values can be
+	// handed over to Initializer methods, which know nothing about them.
+	defaults bool
+
+	// readOnly makes the traversal only collect the paths of the values
+	// which would be replaced, without modifying anything.
+	readOnly bool
+	found    []Path
+
+	// report, when set, collects the changes made by the traversal.
+	report *Report
+
+	// emptyToNil reverses the direction: empty maps and slices are replaced
+	// with nil ones.
+	emptyToNil bool
+
+	// registry provides the type plans, and handlers the functions registered
+	// in it and in the global registry when it was created.
+	registry *Registry
+	handlers []map[reflect.Type]func(reflect.Value)
+}
+
+func newWalker(opts []Option) *walker {
+	w := &walker{
+		opts:          newOptions(opts),
+		exportedField: true,
+		visited:       map[refKey]bool{},
+		allocating:    map[reflect.Type]bool{},
+	}
+	w.defaults = w.opts.defaults()
+	w.registry = registryFor(&w.opts)
+	if h := w.registry.handlers(); len(h) > 0 {
+		w.handlers = append(w.handlers, h)
+	}
+	if h := globalRegistry.handlers(); len(h) > 0 && w.registry != globalRegistry {
+		w.handlers = append(w.handlers, h)
+	}
+	return w
+}
+
+// fail records err together with the current path. Only the first error is
+// kept, except that ErrUnsettable gives way to the errors of other kinds.
+func (w *walker) fail(err error) {
+	if w.err == nil || errors.Is(w.err, ErrUnsettable) && err != ErrUnsettable {
+		w.err = &PathError{Path: w.path.String(), Err: err}
 	}
+}
 
-	initializeNils(v, map[uintptr]bool{})
+// stop records err and stops the traversal. Leaving the rest of the object
+// untouched matters more than anything reported before, so err replaces the
+// errors recorded by fail.
+func (w *walker) stop(err error) {
+	w.err = &PathError{Path: w.path.String(), Err: err}
+	w.stopped = true
+}
 
-	return obj
+// initializeRoot processes the value pointed to by the root pointer v.
+// The root is always followed, regardless of options.
+func (w *walker) initializeRoot(v reflect.Value) {
+	if w.checkVisited(v) || v.IsNil() || !w.relevant(v.Type().Elem(), true) {
+		return
+	}
+	w.ownPackage = ownPackage(v.Type().Elem())
+	w.initializeNils(v.Elem())
+}
+
+// replace stores nv in place of the nil map or slice v.
+//
+// When v can't be set, the value was reached through an unexported field. This is
+// expected for unexported fields themselves, but an exported field (or an element
+// with no field on its path) that can't be updated is reported as ErrUnsettable.
+func (w *walker) replace(v, nv reflect.Value) {
+	if v.CanSet() {
+		if w.readOnly {
+			w.found = append(w.found, Path(w.path.String()))
+			return
+		}
+		v.Set(nv)
+		w.changes++
+		if w.report != nil {
+			w.report.add(Path(w.path.String()), nv.Type())
+		}
+		return
+	}
+	if w.exportedField {
+		w.fail(ErrUnsettable)
+		if w.report != nil {
+			w.report.skip(Path(w.path.String()))
+		}
+	}
 }
 
 // initializeNils recursively traverses the value and replaces nil slices and maps with empty ones.
@@ -31,8 +176,8 @@ func Initialize(obj interface{}) interface{} {
 //     the pointer itself cannot be modified
 //   - The fields inside an unexported pointer field cannot be modified either, as they
 //     belong to a struct that is not addressable through reflection
-func initializeNils(v reflect.Value, visited map[uintptr]bool) {
-	if checkVisited(v, visited) {
+func (w *walker) initializeNils(v reflect.Value) {
+	if w.checkVisited(v) {
 		return
 	}
 
@@ -45,45 +190,95 @@ func initializeNils(v reflect.Value, visited map[uintptr]bool) {
 		return
 	}
 
+	if w.stopped {
+		return
+	}
+	w.nodes++
+	if w.opts.maxNodes > 0 && w.nodes > w.opts.maxNodes {
+		w.stop(ErrMaxNodes)
+		return
+	}
+	if w.ctx != nil && w.nodes%ctxCheckInterval == 0 {
+		if err := w.ctx.Err(); err != nil {
+			w.stop(err)
+			return
+		}
+	}
+	if w.opts.maxDepth > 0 && len(w.path) > w.opts.maxDepth {
+		w.fail(ErrMaxDepth)
+		return
+	}
+
+	if w.callHooks(v) {
+		return
+	}
+
 	switch v.Kind() {
 	case reflect.Pointer:
-		if !v.IsNil() {
-			initializeNils(v.Elem(), visited)
-		}
-	case reflect.Slice:
-		// Initialize a nil slice.
 		if v.IsNil() {
-			if v.CanSet() {
-				v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+			if w.allocatesPointers() && w.opts.allocates(v.Type().Elem()) {
+				w.initializeField(v, fieldTag{alloc: true})
 			}
 			break
 		}
+		if w.opts.pointers {
+			w.initializeNils(v.Elem())
+		}
+	case reflect.Slice:
+		// Initialize a nil slice (or clear an empty one).
+		if v.IsNil() || w.emptyToNil && v.Len() == 0 {
+			w.normalize(v, fieldTag{})
+			break
+		}
+
+		if !w.relevant(v.Type().Elem(), w.exportedField) || w.encodesItself(v) {
+			break
+		}
 
 		// Recursively iterate over slice items.
-		for i := 0; i < v.Len(); i++ {
+		for i := 0; i < v.Len() && !w.stopped; i++ {
 			item := v.Index(i)
-			initializeNils(item, visited)
+			w.path.pushIndex(i)
+			w.initializeNils(item)
+			w.path.pop()
 		}
 
 	case reflect.Map:
-		// Initialize a nil map.
-		if v.IsNil() {
-			if v.CanSet() {
-				v.Set(reflect.MakeMap(v.Type()))
-			}
+		// Initialize a nil map (or clear an empty one).
+		if v.IsNil() || w.emptyToNil && v.Len() == 0 {
+			w.normalize(v, fieldTag{})
 			break
 		}
 
+		if !w.relevant(v.Type().Elem(), w.exportedField) || w.encodesItself(v) {
+			break
+		}
+
+		// A map reached through an unexported field can't be written to,
+		// so its values are only traversed in place.
+		writable := v.CanInterface()
+		irreflexive := w.registry.planFor(v.Type()).irreflexiveKeys
+
 		// Recursively iterate over map items.
 		iter := v.MapRange()
-		for iter.Next() {
-			val := iter.Value()
+		for !w.stopped && iter.Next() {
+			key, val := iter.Key(), iter.Value()
 
 			// If the value is invalid (untyped nil stored in interface{}), skip.
 			if !val.IsValid() {
 				continue
 			}
 
+			w.path.pushKey(key)
+
+			// An entry whose key isn't equal to itself, like NaN, can't
+			// be updated: SetMapIndex would add another entry instead.
+			if !writable || irreflexive && !reflexive(key) {
+				w.initializeNils(val)
+				w.path.pop()
+				continue
+			}
+
 			// Map element (value) can't be set directly; we need an addressable copy.
 			elemType := val.Type()
 			subv := reflect.New(elemType).Elem()
@@ -92,10 +287,15 @@ func initializeNils(v reflect.Value, visited map[uintptr]bool) {
 			subv.Set(val)
 
 			// Replace nil slices and maps inside.
-			initializeNils(subv, visited)
+			changes := w.changes
+			w.initializeNils(subv)
+			w.path.pop()
 
-			// And set the replacement back in the map.
-			v.SetMapIndex(iter.Key(), subv)
+			// And set the replacement back in the map, when there's one.
+			// The entry exists, so the map never grows.
+			if w.changes != changes {
+				v.SetMapIndex(key, subv)
+			}
 		}
 
 	case reflect.Interface:
@@ -104,58 +304,137 @@ func initializeNils(v reflect.Value, visited map[uintptr]bool) {
 			break
 		}
 
-		valueUnderInterface := reflect.ValueOf(v.Interface())
-		if !valueUnderInterface.IsValid() {
-			return
+		valueUnderInterface := v.Elem()
+		if !w.relevant(valueUnderInterface.Type(), w.exportedField) {
+			break
+		}
+
+		// The interface can't be updated, so there is no point in making
+		// a copy; whatever is reachable through pointers is still processed.
+		if !v.CanSet() {
+			w.initializeNils(valueUnderInterface)
+			break
 		}
 
 		elemType := valueUnderInterface.Type()
 		subv := reflect.New(elemType).Elem()
 		subv.Set(valueUnderInterface)
 
-		initializeNils(subv, visited)
+		changes := w.changes
+		w.initializeNils(subv)
 
-		if v.CanSet() {
+		if w.changes != changes {
 			v.Set(subv)
 		}
 
 	// Recursively iterate over array elements.
 	case reflect.Array:
-		for i := 0; i < v.Len(); i++ {
+		if !w.relevant(v.Type().Elem(), w.exportedField) {
+			break
+		}
+		for i := 0; i < v.Len() && !w.stopped; i++ {
 			elem := v.Index(i)
 			if !elem.CanSet() {
 				continue
 			}
-			initializeNils(elem, visited)
+			w.path.pushIndex(i)
+			w.initializeNils(elem)
+			w.path.pop()
 		}
 
 	// Recursively iterate over struct fields.
 	case reflect.Struct:
-		for i := 0; i < v.NumField(); i++ {
-			field := v.Field(i)
-			fieldType := v.Type().Field(i)
+		parentExported := w.exportedField
+		fields := w.registry.planFor(v.Type()).fields
+		for i := 0; i < len(fields) && !w.stopped; i++ {
+			f := &fields[i]
+			if !w.opts.unexported && (f.pointers && !w.allocatesPointers() || f.whenUnexported) {
+				continue
+			}
+			field := v.Field(f.index)
 
-			if fieldType.IsExported() {
+			exported := f.exported
+			if !exported && w.opts.unexported && f.pkgPath == w.ownPackage {
+				field, exported = exposed(field)
+			}
+
+			w.path.pushField(f.name)
+			w.exportedField = exported
+			if exported {
 				// Process exported fields normally - these can be both read and modified
-				initializeNils(field, visited)
-			} else if field.Kind() == reflect.Ptr && !field.IsNil() {
+				w.initializeField(field, w.fieldTag(f))
+			} else if f.promoted {
+				// An unexported embedded struct can't be replaced, but its
+				// exported fields are promoted and can be modified, the same
+				// way whether it's embedded through a pointer or not. A nil
+				// embedded pointer can't be allocated, so it's left nil.
+				w.exportedField = parentExported
+				if field.Kind() != reflect.Pointer || !field.IsNil() {
+					w.initializeField(field, w.fieldTag(f))
+				}
+			} else if field.Kind() == reflect.Ptr {
 				// Handle unexported pointer fields:
 				// Even though the field itself is unexported (and we can't modify the pointer),
 				// we can follow the pointer to process the value it points to.
 				// However, we can't modify fields inside this dereferenced value
 				// because the struct itself is not addressable through reflection.
-				initializeNils(field.Elem(), visited)
+				if !field.IsNil() && w.opts.unexportedPointers {
+					w.initializeNils(field.Elem())
+				}
+			} else if k := field.Kind(); w.report != nil && parentExported && (k == reflect.Map || k == reflect.Slice) && field.IsNil() {
+				// An unexported nil map or slice.
+				w.report.skip(Path(w.path.String()))
 			}
 			// Skip all other unexported fields as we can't modify them without using unsafe
+			w.exportedField = parentExported
+			w.path.pop()
 		}
+	case reflect.Chan:
+		// Initialize a nil channel.
+		if v.IsNil() {
+			w.normalize(v, fieldTag{})
+		}
+
 	default:
 		// Skip unsupported kinds
 	}
 }
 
+// enabled reports whether the options allow initializing values of v's kind.
+func (w *walker) enabled(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice:
+		return w.opts.slices
+	case reflect.Map:
+		return w.opts.maps
+	case reflect.Chan:
+		return w.opts.channels
+	}
+	return false
+}
+
+// makeEmpty creates an empty slice or map of type t with capacity n, or an
+// unbuffered channel of type t. Receive-only and send-only channels are
+// converted from a bidirectional one.
+func makeEmpty(t reflect.Type, n int) reflect.Value {
+	switch t.Kind() {
+	case reflect.Slice:
+		return reflect.MakeSlice(t, 0, n)
+	case reflect.Map:
+		return reflect.MakeMapWithSize(t, n)
+	case reflect.Chan:
+		if t.ChanDir() == reflect.BothDir {
+			return reflect.MakeChan(t, 0)
+		}
+		return reflect.MakeChan(reflect.ChanOf(reflect.BothDir, t.Elem()), 0).Convert(t)
+	}
+	panic("niltoempty: cannot make empty " + t.String())
+}
+
 // checkVisited tracks values we've already processed to avoid infinite recursion
-// in cyclic data structures.
-func checkVisited(v reflect.Value, visited map[uintptr]bool) bool {
+// in cyclic data structures. Values are told apart by their address, type and
+// length, as with copier, so only genuine revisits are skipped.
+func (w *walker) checkVisited(v reflect.Value) bool {
 	if !v.IsValid() {
 		return false
 	}
@@ -165,10 +444,22 @@ func checkVisited(v reflect.Value, visited map[uintptr]bool) bool {
 		if v.IsNil() {
 			return false
 		}
-		p := v.Pointer()
-		wasVisited := visited[p]
-		visited[p] = true
+		// Empty slices have nothing to recurse into, so they can't form
+		// a cycle, and all zero-sized allocations share a single address.
+		if kind == reflect.Slice && v.Len() == 0 {
+			return false
+		}
+		key := refKeyOf(v)
+		wasVisited := w.visited[key]
+		w.visited[key] = true
 		return wasVisited
 	}
 	return false
 }
+
+// reflexive reports whether the map key k is equal to itself, which isn't the
+// case for NaN and the values holding it.
+func reflexive(k reflect.Value) bool {
+	i := k.Interface()
+	return i == i
+}
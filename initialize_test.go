@@ -1,8 +1,10 @@
 package niltoempty_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -1112,3 +1114,252 @@ func TestTimeHandling(t *testing.T) {
 		assert.Empty(t, complex.TimesByTag["test"], "TimesByTag map should be empty")
 	})
 }
+
+func TestInitializeT(t *testing.T) {
+	type Resp struct {
+		Items []string
+		Meta  map[string]int
+	}
+
+	t.Run("pointer", func(t *testing.T) {
+		v := &Resp{}
+		got := niltoempty.InitializeT(v)
+
+		assert.Same(t, v, got)
+		assert.Equal(t, []string{}, got.Items)
+		assert.Equal(t, map[string]int{}, got.Meta)
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		assert.Nil(t, niltoempty.InitializeT[Resp](nil))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		got := niltoempty.InitializeT(&Resp{}, niltoempty.WithMaps(false))
+
+		assert.Equal(t, []string{}, got.Items)
+		assert.Nil(t, got.Meta)
+	})
+}
+
+func TestValue(t *testing.T) {
+	type Resp struct {
+		Items  []string
+		Nested []Resp
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		v := Resp{}
+		got := niltoempty.Value(v)
+
+		assert.Nil(t, v.Items)
+		assert.Equal(t, []string{}, got.Items)
+		assert.Equal(t, []Resp{}, got.Nested)
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		v := Resp{Nested: []Resp{{}}}
+		got := niltoempty.Value(v)
+
+		assert.Equal(t, []string{}, got.Nested[0].Items)
+		assert.Equal(t, []string{}, v.Nested[0].Items)
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		assert.Equal(t, [][]int{{}}, niltoempty.Value([][]int{nil}))
+		assert.Equal(t, []int{}, niltoempty.Value([]int(nil)))
+	})
+}
+
+func TestVisitedAliasing(t *testing.T) {
+	t.Run("first field", func(t *testing.T) {
+		type (
+			Inner struct {
+				S []int
+			}
+			Outer struct {
+				Inner Inner
+				M     map[string]int
+			}
+			Root struct {
+				Inner *Inner
+				Outer *Outer
+			}
+		)
+
+		// A pointer to a struct and a pointer to its first field share the address.
+		o := &Outer{}
+		v := Root{Inner: &o.Inner, Outer: o}
+		niltoempty.Initialize(&v)
+
+		assert.Equal(t, []int{}, o.Inner.S)
+		assert.Equal(t, map[string]int{}, o.M)
+	})
+
+	t.Run("re-sliced array", func(t *testing.T) {
+		type Item struct {
+			S []int
+		}
+
+		items := make([]Item, 4)
+		v := struct {
+			Short []Item
+			Long  []Item
+		}{Short: items[:1], Long: items}
+		niltoempty.Initialize(&v)
+
+		for i, item := range items {
+			assert.Equal(t, []int{}, item.S, "items[%d]", i)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		type Node struct {
+			Next  *Node
+			Items []int
+		}
+
+		n := &Node{}
+		n.Next = &Node{Next: n}
+		niltoempty.Initialize(n)
+
+		assert.Equal(t, []int{}, n.Items)
+		assert.Equal(t, []int{}, n.Next.Items)
+	})
+}
+
+func TestMapWriteBack(t *testing.T) {
+	type Item struct {
+		S []int
+	}
+
+	t.Run("changed entries", func(t *testing.T) {
+		m := map[string]Item{"nil": {}, "set": {S: []int{1}}}
+		niltoempty.Initialize(&m)
+
+		assert.Equal(t, map[string]Item{"nil": {S: []int{}}, "set": {S: []int{1}}}, m)
+	})
+
+	t.Run("interface values", func(t *testing.T) {
+		m := map[string]any{"item": Item{}, "slice": []int(nil), "same": Item{S: []int{1}}}
+		niltoempty.Initialize(&m)
+
+		assert.Equal(t, map[string]any{"item": Item{S: []int{}}, "slice": []int{}, "same": Item{S: []int{1}}}, m)
+	})
+
+	t.Run("NaN keys", func(t *testing.T) {
+		nan := math.NaN()
+		m := map[float64]Item{nan: {}, 1: {}}
+
+		err := niltoempty.InitializeE(&m)
+		require.ErrorIs(t, err, niltoempty.ErrUnsettable)
+
+		// The map doesn't grow and the other entries are updated.
+		require.Len(t, m, 2)
+		assert.Equal(t, Item{S: []int{}}, m[1])
+		for k, v := range m {
+			if k != k {
+				assert.Nil(t, v.S)
+			}
+		}
+	})
+
+	t.Run("NaN in interface keys", func(t *testing.T) {
+		type key struct {
+			F any
+		}
+		m := map[key][]int{{F: math.NaN()}: {1}, {F: "a"}: {2}}
+		s := map[key][]Item{{F: math.NaN()}: {{}}, {F: 1}: {{}}}
+		niltoempty.Initialize(&m)
+		niltoempty.Initialize(&s)
+
+		assert.Len(t, m, 2)
+		assert.Len(t, s, 2)
+		assert.Equal(t, []Item{{S: []int{}}}, s[key{F: 1}])
+	})
+}
+
+type (
+	promotedMeta struct {
+		Tags  []string `json:"tags"`
+		notes []string
+	}
+	promotedLinks struct {
+		Self []string `json:"self"`
+	}
+	promotedResp struct {
+		promotedMeta
+		*promotedLinks
+		Items []int `json:"items"`
+	}
+)
+
+func TestPromotedFields(t *testing.T) {
+	t.Run("initialized", func(t *testing.T) {
+		v := promotedResp{promotedLinks: &promotedLinks{}}
+		niltoempty.Initialize(&v)
+
+		assert.Equal(t, []string{}, v.Tags)
+		assert.Nil(t, v.notes)
+		assert.Equal(t, []string{}, v.Self)
+
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"tags":[],"self":[],"items":[]}`, string(b))
+	})
+
+	t.Run("nil pointer", func(t *testing.T) {
+		v := promotedResp{}
+		require.NoError(t, niltoempty.InitializeE(&v, niltoempty.WithAllocPointers(true)))
+
+		assert.Nil(t, v.promotedLinks)
+		assert.Equal(t, []string{}, v.Tags)
+	})
+
+	t.Run("in slices", func(t *testing.T) {
+		v := []promotedResp{{}, {promotedLinks: &promotedLinks{}}}
+		niltoempty.Initialize(&v)
+
+		assert.Equal(t, []string{}, v[0].Tags)
+		assert.Equal(t, []string{}, v[1].Self)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		v := promotedResp{promotedLinks: &promotedLinks{}}
+		assert.Equal(t,
+			[]niltoempty.Path{".promotedMeta.Tags", ".promotedLinks.Self", ".Items"},
+			niltoempty.Find(&v))
+	})
+
+	t.Run("Encoder", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, niltoempty.NewEncoder(&buf).Encode(promotedResp{}))
+		assert.JSONEq(t, `{"tags":[],"items":[]}`, buf.String())
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		v := promotedResp{promotedMeta: promotedMeta{Tags: []string{"a"}}, promotedLinks: &promotedLinks{}}
+		c := niltoempty.Clone(v)
+
+		c.Tags[0] = "b"
+		assert.Equal(t, []string{"a"}, v.Tags)
+
+		// The embedded pointer is copied, so it's initialized in the
+		// clone only.
+		assert.Nil(t, v.Self)
+		assert.Equal(t, []string{}, c.Self)
+		assert.NotSame(t, v.promotedLinks, c.promotedLinks)
+	})
+
+	t.Run("Wrap", func(t *testing.T) {
+		v := promotedResp{promotedLinks: &promotedLinks{}}
+		b, err := json.Marshal(niltoempty.Wrap(v))
+		require.NoError(t, err)
+
+		want, err := json.Marshal(niltoempty.Clone(v))
+		require.NoError(t, err)
+		assert.JSONEq(t, string(want), string(b))
+		assert.JSONEq(t, `{"tags":[],"self":[],"items":[]}`, string(b))
+		assert.Nil(t, v.Self)
+	})
+}
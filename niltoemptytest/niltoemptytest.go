@@ -0,0 +1,47 @@
+// Package niltoemptytest provides test helpers checking that values hold no nil
+// maps or slices, e.g. ones which would be serialized as null by json.Marshal.
+package niltoemptytest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+)
+
+// AssertNoNils checks that v holds no nil maps or slices which niltoempty.InitializeWith,
+// called with the same opts, would replace. Otherwise it marks the test as failed
+// and logs the paths of the offending values.
+//
+// It returns whether the check passed.
+func AssertNoNils(t testing.TB, v interface{}, opts ...niltoempty.Option) bool {
+	t.Helper()
+
+	paths := niltoempty.Find(v, opts...)
+	if len(paths) == 0 {
+		return true
+	}
+
+	t.Errorf("%s", failureMessage(v, paths))
+	return false
+}
+
+// RequireNoNils works like AssertNoNils but stops the test on failure.
+func RequireNoNils(t testing.TB, v interface{}, opts ...niltoempty.Option) {
+	t.Helper()
+
+	if !AssertNoNils(t, v, opts...) {
+		t.FailNow()
+	}
+}
+
+func failureMessage(v interface{}, paths []niltoempty.Path) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%T holds %d nil map(s) or slice(s):", v, len(paths))
+	for _, p := range paths {
+		b.WriteString("\n\t")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package niltoemptytest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/pkierski/niltoempty/niltoemptytest"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT records failures instead of failing the test.
+type recordingT struct {
+	testing.TB
+	errors []string
+	failed bool
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) FailNow() {
+	t.failed = true
+}
+
+type (
+	order struct {
+		Items []string `json:"items,omitempty"`
+	}
+	resp struct {
+		Orders []order         `json:"orders"`
+		Meta   map[string]any  `json:"meta"`
+		Extra  *map[string]any `json:"extra"`
+	}
+)
+
+func TestAssertNoNils(t *testing.T) {
+	t.Run("passes", func(t *testing.T) {
+		rt := &recordingT{}
+		v := resp{Orders: []order{}, Meta: map[string]any{}}
+
+		assert.True(t, niltoemptytest.AssertNoNils(rt, v))
+		assert.True(t, niltoemptytest.AssertNoNils(rt, &v))
+		assert.Empty(t, rt.errors)
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		rt := &recordingT{}
+		v := resp{
+			Orders: []order{{Items: []string{}}, {}},
+			Meta:   map[string]any{"tags": []string(nil)},
+		}
+
+		assert.False(t, niltoemptytest.AssertNoNils(rt, &v))
+		assert.Equal(t, []string{
+			"*niltoemptytest_test.resp holds 2 nil map(s) or slice(s):\n" +
+				"\t.Orders[1].Items\n" +
+				"\t.Meta[\"tags\"]",
+		}, rt.errors)
+		assert.False(t, rt.failed)
+		assert.Nil(t, v.Orders[1].Items, "value is not modified")
+	})
+
+	t.Run("options", func(t *testing.T) {
+		rt := &recordingT{}
+		v := resp{Orders: []order{{}}, Meta: map[string]any{}}
+
+		assert.True(t, niltoemptytest.AssertNoNils(rt, v, niltoempty.WithJSONTags(true)))
+		assert.Empty(t, rt.errors)
+	})
+}
+
+func TestRequireNoNils(t *testing.T) {
+	rt := &recordingT{}
+	niltoemptytest.RequireNoNils(rt, resp{Orders: []order{}, Meta: map[string]any{}})
+	assert.False(t, rt.failed)
+
+	niltoemptytest.RequireNoNils(rt, resp{})
+	assert.True(t, rt.failed)
+	assert.Len(t, rt.errors, 1)
+}
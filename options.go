@@ -0,0 +1,247 @@
+package niltoempty
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Option configures the traversal performed by InitializeWith and InitializeE.
+type Option func(*options)
+
+// options holds the behavior of a single traversal. The zero value is not
+// meaningful; use defaultOptions.
+type options struct {
+	maps     bool
+	slices   bool
+	channels bool
+
+	pointers           bool
+	unexportedPointers bool
+
+	// allocPointers and allocTypes select the nil pointers which are
+	// allocated: all of them, or the ones pointing to the listed types.
+	allocPointers bool
+	allocTypes    map[reflect.Type]bool
+
+	maxDepth int
+	maxNodes int
+
+	jsonTags bool
+
+	unexported bool
+
+	// marshalers makes slices and maps encoding themselves processed too,
+	// and emptyRawMessage, when set, replaces nil json.RawMessage values.
+	marshalers      bool
+	emptyRawMessage json.RawMessage
+
+	bytes BytesPolicy
+
+	registry *Registry
+
+	// noHooks makes values traversed through reflection even when they
+	// implement Initializer or their types have registered functions.
+	noHooks bool
+}
+
+// defaultOptions returns the behavior of Initialize.
+func defaultOptions() options {
+	return options{
+		maps:               true,
+		slices:             true,
+		pointers:           true,
+		unexportedPointers: true,
+	}
+}
+
+// defaults reports whether o is the same as defaultOptions, apart from the
+// registry used.
+func (o *options) defaults() bool {
+	d := defaultOptions()
+	d.registry = o.registry
+	return reflect.DeepEqual(*o, d)
+}
+
+func newOptions(opts []Option) options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithMaps controls whether nil maps are replaced with empty ones. Enabled by default.
+func WithMaps(enabled bool) Option {
+	return func(o *options) {
+		o.maps = enabled
+	}
+}
+
+// WithSlices controls whether nil slices are replaced with empty ones. Enabled by default.
+func WithSlices(enabled bool) Option {
+	return func(o *options) {
+		o.slices = enabled
+	}
+}
+
+// WithChannels controls whether nil channels are replaced with new unbuffered
+// ones. Disabled by default.
+func WithChannels(enabled bool) Option {
+	return func(o *options) {
+		o.channels = enabled
+	}
+}
+
+// WithPointers controls whether non-nil pointers are followed. Enabled by default.
+// Nil pointers are never followed.
+func WithPointers(enabled bool) Option {
+	return func(o *options) {
+		o.pointers = enabled
+	}
+}
+
+// WithUnexportedPointers controls whether non-nil unexported pointer fields are
+// followed. Enabled by default.
+//
+// Only the exported fields of values reached this way could be initialized,
+// but reflection doesn't allow setting them, so the traversal is useful mostly
+// for reaching pointers, maps and interfaces stored further down.
+//
+// Unexported embedded pointers to structs are followed regardless, as the
+// exported fields of the structs they point to are promoted and encoding/json
+// serializes them.
+func WithUnexportedPointers(enabled bool) Option {
+	return func(o *options) {
+		o.unexportedPointers = enabled
+	}
+}
+
+// WithAllocPointers controls whether nil pointers to slices, maps and structs are
+// allocated, the same way as fields with the alloc tag are. Disabled by default,
+// as such pointers usually model optional values.
+//
+// A new slice or map is empty and a new struct is initialized in turn. Nil
+// pointers to a struct type are left nil within a struct of the same type
+// allocated this way, so recursive types don't make the allocation go on forever.
+func WithAllocPointers(enabled bool) Option {
+	return func(o *options) {
+		o.allocPointers = enabled
+	}
+}
+
+// WithAllocPointersTo makes nil pointers to T allocated, as with WithAllocPointers,
+// leaving the pointers to other types alone. T must be a slice, map or struct type.
+func WithAllocPointersTo[T any]() Option {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	return func(o *options) {
+		if o.allocTypes == nil {
+			o.allocTypes = map[reflect.Type]bool{}
+		}
+		o.allocTypes[t] = true
+	}
+}
+
+// allocates reports whether nil pointers to t are allocated.
+func (o *options) allocates(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return o.allocPointers || o.allocTypes[t]
+	}
+	return false
+}
+
+// WithMarshalers controls whether slices and maps of types implementing
+// json.Marshaler or encoding.TextMarshaler are processed like the others.
+// Disabled by default.
+//
+// Such types decide on their encoding themselves, and a nil value may encode
+// differently than an empty one: a nil json.RawMessage encodes as null while
+// an empty one can't be encoded at all. That's why they are left untouched,
+// together with everything they hold, unless enabled.
+func WithMarshalers(enabled bool) Option {
+	return func(o *options) {
+		o.marshalers = enabled
+	}
+}
+
+// BytesPolicy selects what happens to nil byte slices, including named types
+// of them. encoding/json encodes byte slices as base64 strings, so an empty one
+// becomes "" rather than null, unlike the [] other slices become.
+type BytesPolicy int
+
+const (
+	// BytesEmpty replaces nil byte slices with empty ones, like other slices.
+	// It's the default.
+	BytesEmpty BytesPolicy = iota
+	// BytesNil leaves nil byte slices nil.
+	BytesNil
+	// BytesTagged replaces nil byte slices held by struct fields with the
+	// bytes option of the niltoempty tag, leaving the others nil.
+	BytesTagged
+)
+
+// WithBytes sets the policy for nil byte slices. BytesEmpty by default.
+func WithBytes(policy BytesPolicy) Option {
+	return func(o *options) {
+		o.bytes = policy
+	}
+}
+
+// WithEmptyRawMessage makes nil json.RawMessage values replaced with copies of
+// raw, e.g. json.RawMessage("{}") or json.RawMessage("[]"), regardless of
+// WithMarshalers. It panics when raw isn't valid JSON.
+func WithEmptyRawMessage(raw json.RawMessage) Option {
+	if !json.Valid(raw) {
+		panic("niltoempty: invalid JSON for empty json.RawMessage: " + string(raw))
+	}
+	raw = append(json.RawMessage(nil), raw...)
+	return func(o *options) {
+		o.emptyRawMessage = raw
+	}
+}
+
+// WithMaxDepth limits the traversal to values at most n fields, indexes or map
+// keys away from the root. Values nested deeper are left untouched, which
+// InitializeE reports as ErrMaxDepth.
+// Zero or negative n means no limit, which is the default.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// WithMaxNodes limits the traversal to n values, counting the structs, fields,
+// elements and values pointed to it visits. When the limit is exceeded, the
+// traversal stops, leaving the rest of the object untouched, which InitializeE
+// reports as ErrMaxNodes.
+// Zero or negative n means no limit, which is the default.
+func WithMaxNodes(n int) Option {
+	return func(o *options) {
+		o.maxNodes = n
+	}
+}
+
+// WithJSONTags controls whether encoding/json struct tags are honored. Disabled by default.
+//
+// When enabled, fields tagged `json:"-"` are skipped together with everything
+// reachable through them, as they are never serialized. Nil fields tagged with
+// omitempty are left nil so they keep being omitted; non-nil ones are still
+// processed.
+func WithJSONTags(enabled bool) Option {
+	return func(o *options) {
+		o.jsonTags = enabled
+	}
+}
+
+// InitializeWith works like Initialize with the behavior adjusted by opts.
+// Initialize is equivalent to InitializeWith called without options.
+func InitializeWith(obj interface{}, opts ...Option) interface{} {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr {
+		panic("niltoempty: expected pointer")
+	}
+
+	newWalker(opts).initializeRoot(v)
+
+	return obj
+}
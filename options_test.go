@@ -0,0 +1,369 @@
+package niltoempty_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializeWith(t *testing.T) {
+	type (
+		Inner struct {
+			S []int          `json:"s"`
+			M map[string]int `json:"m"`
+		}
+		Outer struct {
+			S     []int          `json:"s"`
+			M     map[string]int `json:"m"`
+			I     Inner          `json:"i"`
+			P     *Inner         `json:"p"`
+			inner *Inner
+		}
+	)
+	newOuter := func() Outer {
+		return Outer{P: &Inner{}, inner: &Inner{M: map[string]int{}}}
+	}
+
+	tests := []struct {
+		name string
+		opts []niltoempty.Option
+		want string
+	}{
+		{
+			name: "defaults",
+			want: `{"s":[],"m":{},"i":{"s":[],"m":{}},"p":{"s":[],"m":{}}}`,
+		},
+		{
+			name: "without maps",
+			opts: []niltoempty.Option{niltoempty.WithMaps(false)},
+			want: `{"s":[],"m":null,"i":{"s":[],"m":null},"p":{"s":[],"m":null}}`,
+		},
+		{
+			name: "without slices",
+			opts: []niltoempty.Option{niltoempty.WithSlices(false)},
+			want: `{"s":null,"m":{},"i":{"s":null,"m":{}},"p":{"s":null,"m":{}}}`,
+		},
+		{
+			name: "without pointers",
+			opts: []niltoempty.Option{niltoempty.WithPointers(false)},
+			want: `{"s":[],"m":{},"i":{"s":[],"m":{}},"p":{"s":null,"m":null}}`,
+		},
+		{
+			name: "max depth",
+			opts: []niltoempty.Option{niltoempty.WithMaxDepth(1)},
+			want: `{"s":[],"m":{},"i":{"s":null,"m":null},"p":{"s":null,"m":null}}`,
+		},
+		{
+			name: "last option wins",
+			opts: []niltoempty.Option{niltoempty.WithMaps(false), niltoempty.WithMaps(true)},
+			want: `{"s":[],"m":{},"i":{"s":[],"m":{}},"p":{"s":[],"m":{}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newOuter()
+
+			b, err := json.Marshal(niltoempty.InitializeWith(&v, tt.opts...))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+
+	t.Run("panics on non-pointer", func(t *testing.T) {
+		assert.Panics(t, func() {
+			niltoempty.InitializeWith(newOuter(), niltoempty.WithMaps(false))
+		})
+	})
+}
+
+func TestWithChannels(t *testing.T) {
+	type C struct {
+		C  chan int
+		R  <-chan int
+		S  chan<- int
+		NC chan int
+	}
+
+	var v C
+	niltoempty.Initialize(&v)
+	assert.Nil(t, v.C, "channels are not initialized by default")
+
+	niltoempty.InitializeWith(&v, niltoempty.WithChannels(true))
+	assert.NotNil(t, v.C)
+	assert.NotNil(t, v.R)
+	assert.NotNil(t, v.S)
+	assert.Zero(t, cap(v.C))
+}
+
+func TestWithUnexportedPointers(t *testing.T) {
+	type (
+		Inner struct {
+			M map[string][]int
+		}
+		Outer struct {
+			inner *Inner
+		}
+	)
+	v := Outer{inner: &Inner{M: map[string][]int{"a": nil}}}
+
+	assert.NoError(t, niltoempty.InitializeE(&v, niltoempty.WithUnexportedPointers(false)))
+	assert.ErrorIs(t, niltoempty.InitializeE(&v), niltoempty.ErrUnsettable)
+}
+
+func TestWithJSONTags(t *testing.T) {
+	type (
+		Inner struct {
+			S []int `json:"s"`
+		}
+		S struct {
+			Ignored     []int           `json:"-"`
+			IgnoredTree []Inner         `json:"-"`
+			Dash        []int           `json:"-,"`
+			Omitted     []int           `json:"omitted,omitempty"`
+			OmittedMap  map[string]int  `json:"omitted_map,omitempty"`
+			OmittedPtr  *Inner          `json:"omitted_ptr,omitempty"`
+			Present     []Inner         `json:"present,omitempty"`
+			PresentPtr  *[]int          `json:"present_ptr,omitempty"`
+			Alloc       *map[string]int `json:"alloc,omitempty" niltoempty:"alloc"`
+			Plain       []int           `json:"plain"`
+		}
+	)
+	var nilSlice []int
+	newS := func() S {
+		return S{
+			IgnoredTree: []Inner{{}},
+			OmittedPtr:  &Inner{},
+			Present:     []Inner{{}},
+			PresentPtr:  &nilSlice,
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		v := newS()
+		niltoempty.Initialize(&v)
+
+		assert.NotNil(t, v.Ignored)
+		assert.NotNil(t, v.IgnoredTree[0].S)
+		assert.NotNil(t, v.Omitted)
+		assert.NotNil(t, v.Alloc)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		v := newS()
+		niltoempty.InitializeWith(&v, niltoempty.WithJSONTags(true))
+
+		assert.Nil(t, v.Ignored)
+		assert.Nil(t, v.IgnoredTree[0].S)
+		assert.NotNil(t, v.Dash, `field named "-" is serialized`)
+		assert.Nil(t, v.Omitted)
+		assert.Nil(t, v.OmittedMap)
+		assert.Nil(t, v.Alloc)
+		assert.NotNil(t, v.Plain)
+
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		assert.Equal(t, `{"-":[],"omitted_ptr":{"s":[]},"present":[{"s":[]}],"present_ptr":[],"plain":[]}`, string(b))
+	})
+}
+
+func TestWithAllocPointers(t *testing.T) {
+	type (
+		Node struct {
+			Next  *Node
+			Items []int
+		}
+		Row struct {
+			Cells *[]string
+			Attrs *map[string]string
+			Node  *Node
+			Count *int
+			When  *time.Time
+		}
+		Table struct {
+			Rows  []*Row
+			ByID  map[string]*Row
+			First *Row
+			Any   any
+			last  *Row
+		}
+	)
+
+	t.Run("disabled", func(t *testing.T) {
+		v := Table{}
+		niltoempty.Initialize(&v)
+
+		assert.Nil(t, v.First)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		v := Table{Rows: []*Row{nil}, ByID: map[string]*Row{"a": nil}, Any: (*Row)(nil)}
+		niltoempty.InitializeWith(&v, niltoempty.WithAllocPointers(true))
+
+		for _, row := range []*Row{v.First, v.Rows[0], v.ByID["a"], v.Any.(*Row)} {
+			require.NotNil(t, row)
+			assert.Equal(t, []string{}, *row.Cells)
+			assert.Equal(t, map[string]string{}, *row.Attrs)
+			assert.Nil(t, row.Count)
+			assert.Equal(t, &time.Time{}, row.When)
+
+			// A struct isn't allocated within a struct of the same type.
+			require.NotNil(t, row.Node)
+			assert.Equal(t, []int{}, row.Node.Items)
+			assert.Nil(t, row.Node.Next)
+		}
+		assert.Nil(t, v.last)
+	})
+
+	t.Run("per type", func(t *testing.T) {
+		v := Table{First: &Row{}}
+		niltoempty.InitializeWith(&v, niltoempty.WithAllocPointersTo[[]string](), niltoempty.WithAllocPointersTo[Node]())
+
+		assert.Equal(t, []string{}, *v.First.Cells)
+		assert.Nil(t, v.First.Attrs)
+		assert.Equal(t, &Node{Items: []int{}}, v.First.Node)
+		assert.Nil(t, v.First.When)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		v := Row{}
+		assert.Equal(t,
+			[]niltoempty.Path{".Cells", ".Attrs"},
+			niltoempty.Find(&v, niltoempty.WithAllocPointersTo[[]string](), niltoempty.WithAllocPointersTo[map[string]string]()))
+		assert.Nil(t, v.Cells)
+	})
+}
+
+// encodedList encodes itself, so its elements are left alone as well.
+type encodedList [][]int
+
+func (l encodedList) MarshalJSON() ([]byte, error) {
+	return json.Marshal([][]int(l))
+}
+
+func TestWithMarshalers(t *testing.T) {
+	type Resp struct {
+		Raw    json.RawMessage  `json:"raw"`
+		IP     net.IP           `json:"ip"`
+		List   encodedList      `json:"list"`
+		RawPtr *json.RawMessage `json:"rawPtr"`
+		S      []int            `json:"s"`
+	}
+
+	t.Run("left alone by default", func(t *testing.T) {
+		v := Resp{List: encodedList{nil}}
+		niltoempty.Initialize(&v)
+
+		assert.Nil(t, v.Raw)
+		assert.Nil(t, v.IP)
+		assert.Equal(t, encodedList{nil}, v.List)
+		assert.Equal(t, []int{}, v.S)
+
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"raw":null,"ip":"","list":[null],"rawPtr":null,"s":[]}`, string(b))
+	})
+
+	t.Run("allocated pointer", func(t *testing.T) {
+		v := Resp{}
+		niltoempty.InitializeWith(&v, niltoempty.WithAllocPointers(true))
+
+		require.NotNil(t, v.RawPtr)
+		assert.Nil(t, *v.RawPtr)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		v := Resp{List: encodedList{nil}}
+		niltoempty.InitializeWith(&v, niltoempty.WithMarshalers(true))
+
+		assert.Equal(t, json.RawMessage{}, v.Raw)
+		assert.Equal(t, net.IP{}, v.IP)
+		assert.Equal(t, encodedList{{}}, v.List)
+	})
+
+	t.Run("empty raw message", func(t *testing.T) {
+		raw := json.RawMessage(`{}`)
+		v := []Resp{{}, {}}
+		niltoempty.InitializeWith(&v, niltoempty.WithEmptyRawMessage(raw))
+
+		assert.Equal(t, json.RawMessage(`{}`), v[0].Raw)
+		assert.Nil(t, v[0].IP)
+
+		// Each value gets its own copy.
+		v[0].Raw[0] = '['
+		assert.Equal(t, json.RawMessage(`{}`), v[1].Raw)
+		assert.Equal(t, json.RawMessage(`{}`), raw)
+
+		b, err := json.Marshal(v[1])
+		require.NoError(t, err)
+		assert.Contains(t, string(b), `"raw":{}`)
+	})
+
+	t.Run("invalid raw message", func(t *testing.T) {
+		assert.Panics(t, func() { niltoempty.WithEmptyRawMessage(json.RawMessage(`{`)) })
+	})
+
+	t.Run("Wrap", func(t *testing.T) {
+		b, err := json.Marshal(niltoempty.Wrap(Resp{}))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"raw":null,"ip":"","list":null,"rawPtr":null,"s":[]}`, string(b))
+	})
+}
+
+type blob []byte
+
+func TestWithBytes(t *testing.T) {
+	type Msg struct {
+		Data    []byte   `json:"data"`
+		Blob    blob     `json:"blob"`
+		Tagged  []byte   `json:"tagged" niltoempty:"bytes,cap=8"`
+		Ptr     *[]byte  `json:"ptr" niltoempty:"alloc"`
+		Chunks  [][]byte `json:"chunks"`
+		Numbers []int    `json:"numbers"`
+	}
+
+	t.Run("empty by default", func(t *testing.T) {
+		v := Msg{Chunks: [][]byte{nil}}
+		niltoempty.Initialize(&v)
+
+		assert.Equal(t, []byte{}, v.Data)
+		assert.Equal(t, blob{}, v.Blob)
+		require.NotNil(t, v.Ptr)
+		assert.Equal(t, []byte{}, *v.Ptr)
+		assert.Equal(t, [][]byte{{}}, v.Chunks)
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		v := Msg{Chunks: [][]byte{nil}}
+		niltoempty.InitializeWith(&v, niltoempty.WithBytes(niltoempty.BytesNil))
+
+		assert.Nil(t, v.Data)
+		assert.Nil(t, v.Blob)
+		assert.Nil(t, v.Tagged)
+		require.NotNil(t, v.Ptr)
+		assert.Nil(t, *v.Ptr)
+		assert.Equal(t, [][]byte{nil}, v.Chunks)
+		assert.Equal(t, []int{}, v.Numbers)
+
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"data":null,"blob":null,"tagged":null,"ptr":null,"chunks":[null],"numbers":[]}`, string(b))
+		assert.Empty(t, niltoempty.Find(&v, niltoempty.WithBytes(niltoempty.BytesNil)))
+	})
+
+	t.Run("tagged", func(t *testing.T) {
+		v := Msg{Chunks: [][]byte{nil}}
+		niltoempty.InitializeWith(&v, niltoempty.WithBytes(niltoempty.BytesTagged))
+
+		assert.Nil(t, v.Data)
+		assert.Nil(t, v.Blob)
+		assert.Equal(t, []byte{}, v.Tagged)
+		assert.Equal(t, 8, cap(v.Tagged))
+		assert.Equal(t, [][]byte{nil}, v.Chunks)
+		assert.Equal(t, []int{}, v.Numbers)
+	})
+}
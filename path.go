@@ -0,0 +1,82 @@
+package niltoempty
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Path describes the location of a value inside a traversed object in Go
+// syntax, e.g. `.Orders[3].Items` or `.Meta["tags"]`. The root object itself
+// is ".".
+type Path string
+
+func (p Path) String() string {
+	return string(p)
+}
+
+// step is a single element of a path: a struct field, a slice or array index,
+// or a map key.
+type step struct {
+	field string
+	index int
+	key   reflect.Value
+}
+
+// path leads from the root of a traversal to the current value. It is only
+// rendered to a string when needed, so building it is cheap.
+type path []step
+
+func (p *path) pushField(name string) {
+	*p = append(*p, step{field: name})
+}
+
+func (p *path) pushIndex(i int) {
+	*p = append(*p, step{index: i})
+}
+
+func (p *path) pushKey(k reflect.Value) {
+	*p = append(*p, step{key: k})
+}
+
+func (p *path) pop() {
+	*p = (*p)[:len(*p)-1]
+}
+
+// String renders the path in Go syntax, e.g. `.Orders[3].Meta["tags"]`.
+// The root itself is rendered as ".".
+func (p path) String() string {
+	if len(p) == 0 {
+		return "."
+	}
+
+	var b strings.Builder
+	for _, s := range p {
+		switch {
+		case s.field != "":
+			b.WriteByte('.')
+			b.WriteString(s.field)
+		case s.key.IsValid():
+			b.WriteByte('[')
+			b.WriteString(formatKey(s.key))
+			b.WriteByte(']')
+		default:
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(s.index))
+			b.WriteByte(']')
+		}
+	}
+	return b.String()
+}
+
+// formatKey renders a map key, quoting strings.
+func formatKey(k reflect.Value) string {
+	if k.Kind() == reflect.Interface && !k.IsNil() {
+		k = k.Elem()
+	}
+	if k.Kind() == reflect.String {
+		return strconv.Quote(k.String())
+	}
+	return fmt.Sprint(k)
+}
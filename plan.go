@@ -0,0 +1,325 @@
+package niltoempty
+
+import (
+	"reflect"
+)
+
+// typePlan is what the traversal needs to know about a type. It is computed
+// once per type and cached, so the traversal doesn't inspect struct fields
+// and tags through reflection over and over again, and it can skip values
+// which can't hold anything to initialize, like time.Time or []int, at once.
+type typePlan struct {
+	// exported and hidden report whether a value of the type may hold anything
+	// the traversal acts on, when reached through an exported or an unexported
+	// field respectively. Values reached through unexported fields can't be
+	// modified, so only exported fields inside them matter for reporting.
+	exported bool
+	hidden   bool
+
+	// pointers reports whether a value of the type, reached through an
+	// exported field, may hold a nil pointer which could be allocated.
+	pointers bool
+
+	// unexported reports whether a value of the type may hold anything the
+	// traversal acts on when unexported fields are processed too.
+	unexported bool
+
+	// irreflexiveKeys is set for map types whose keys may not be equal to
+	// themselves, like NaN.
+	irreflexiveKeys bool
+
+	// marshaler is set for slice and map types implementing json.Marshaler
+	// or encoding.TextMarshaler, which encode themselves.
+	marshaler bool
+
+	// initializer and skipper tell how the type implements Initializer
+	// and Skipper.
+	initializer receiver
+	skipper     receiver
+
+	// acyclic is set for types implementing Initializer whose values can't
+	// be part of cycles, judging by their types: no type reachable from the
+	// type refers back to itself and no interface is reachable.
+	acyclic bool
+
+	// fields lists the struct fields worth visiting, in declaration order.
+	fields []fieldPlan
+}
+
+// fieldPlan is what the traversal needs to know about a struct field.
+type fieldPlan struct {
+	index    int
+	name     string
+	exported bool
+
+	// pkgPath is the package declaring the field when it's unexported.
+	pkgPath string
+
+	// promoted is set for unexported embedded structs and pointers to them,
+	// whose exported fields are promoted and can be set.
+	promoted bool
+
+	// pointers is set for the fields visited only for the nil pointers
+	// they may hold, and whenUnexported for the ones visited only when
+	// unexported fields are processed.
+	pointers       bool
+	whenUnexported bool
+
+	// tag is the parsed niltoempty tag and json the parsed json tag.
+	tag  fieldTag
+	json fieldTag
+}
+
+// planFor returns the plan of the type t for the traversals using r.
+func (r *Registry) planFor(t reflect.Type) *typePlan {
+	if p, ok := r.plans.Load(t); ok {
+		return p.(*typePlan)
+	}
+	p, _ := r.plans.LoadOrStore(t, r.newPlan(t))
+	return p.(*typePlan)
+}
+
+// relevant reports whether a value of the type t, reached through an exported
+// field when exported is true, may hold anything the traversal acts on.
+func (w *walker) relevant(t reflect.Type, exported bool) bool {
+	p := w.registry.planFor(t)
+	if w.opts.unexported {
+		return p.unexported
+	}
+	if exported {
+		return p.exported || p.pointers && w.allocatesPointers()
+	}
+	return p.hidden
+}
+
+// allocatesPointers reports whether the traversal allocates nil pointers.
+func (w *walker) allocatesPointers() bool {
+	return !w.emptyToNil && (w.opts.allocPointers || len(w.opts.allocTypes) > 0)
+}
+
+func (r *Registry) newPlan(t reflect.Type) *typePlan {
+	p := &typePlan{
+		exported:    r.reaches(t, true, map[planKey]bool{}),
+		hidden:      r.reaches(t, false, map[planKey]bool{}),
+		pointers:    reachesPointer(t, map[reflect.Type]bool{}),
+		unexported:  r.reachesUnexported(t, map[reflect.Type]bool{}),
+		initializer: receiverOf(t, initializerType),
+		skipper:     receiverOf(t, skipperType),
+	}
+	if p.initializer != noReceiver {
+		p.acyclic = isAcyclic(t, map[reflect.Type]bool{}, map[reflect.Type]bool{})
+	}
+	if t.Kind() == reflect.Map {
+		p.irreflexiveKeys = mayBeIrreflexive(t.Key())
+	}
+	if t.Kind() == reflect.Map || t.Kind() == reflect.Slice {
+		p.marshaler = isMarshaler(t)
+	}
+	if t.Kind() != reflect.Struct {
+		return p
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		f := fieldPlan{
+			index:    i,
+			name:     sf.Name,
+			exported: sf.IsExported(),
+			pkgPath:  sf.PkgPath,
+			promoted: isPromoted(sf),
+			tag:      parseTag(sf.Tag),
+			json:     parseJSONTag(sf.Tag),
+		}
+		if r.visited(&f, sf.Type) {
+			p.fields = append(p.fields, f)
+		} else if f.exported && reachesPointer(sf.Type, map[reflect.Type]bool{}) {
+			f.pointers = true
+			p.fields = append(p.fields, f)
+		} else if !f.exported && r.reachesUnexported(sf.Type, map[reflect.Type]bool{}) {
+			f.whenUnexported = true
+			p.fields = append(p.fields, f)
+		}
+	}
+	return p
+}
+
+// visited reports whether the traversal has to visit the field f of type t.
+func (r *Registry) visited(f *fieldPlan, t reflect.Type) bool {
+	if f.exported {
+		return f.tag.alloc || r.reaches(t, true, map[planKey]bool{})
+	}
+	if f.promoted {
+		return r.reaches(t, true, map[planKey]bool{})
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return r.reaches(t.Elem(), false, map[planKey]bool{})
+	case reflect.Map, reflect.Slice:
+		// Reported as skipped when nil.
+		return true
+	}
+	return false
+}
+
+type planKey struct {
+	typ      reflect.Type
+	exported bool
+}
+
+// reaches reports whether a value of type t may hold a map, slice, channel
+// or interface the traversal acts on. It follows the same rules as
+// initializeNils: exported fields are processed, unexported pointer fields
+// are followed and other unexported fields are skipped.
+//
+// Every call explores the whole type graph reachable from t, so the result
+// is correct for recursive types as well.
+func (r *Registry) reaches(t reflect.Type, exported bool, seen map[planKey]bool) bool {
+	key := planKey{typ: t, exported: exported}
+	if seen[key] {
+		return false
+	}
+	seen[key] = true
+
+	if receiverOf(t, initializerType) != noReceiver {
+		return true
+	}
+	if _, ok := r.handler(t); ok && exported {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map:
+		return exported || r.reaches(t.Elem(), exported, seen)
+	case reflect.Chan:
+		return exported
+	case reflect.Interface:
+		// The dynamic type is checked during the traversal.
+		return true
+	case reflect.Pointer, reflect.Array:
+		return r.reaches(t.Elem(), exported, seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			switch {
+			case sf.IsExported():
+				if parseTag(sf.Tag).alloc || r.reaches(sf.Type, true, seen) {
+					return true
+				}
+			case isPromoted(sf):
+				if r.reaches(sf.Type, exported, seen) {
+					return true
+				}
+			case sf.Type.Kind() == reflect.Pointer:
+				if r.reaches(sf.Type.Elem(), false, seen) {
+					return true
+				}
+			case sf.Type.Kind() == reflect.Map || sf.Type.Kind() == reflect.Slice:
+				if exported {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isAcyclic reports whether no type reachable from t refers back to itself and
+// no interface is reachable, so values of type t can't be part of cycles. The
+// types on the current path are in path, and done holds the ones known to be
+// acyclic.
+func isAcyclic(t reflect.Type, path, done map[reflect.Type]bool) bool {
+	if done[t] {
+		return true
+	}
+	if path[t] {
+		return false
+	}
+	path[t] = true
+	defer delete(path, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return false
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Array:
+		if !isAcyclic(t.Elem(), path, done) {
+			return false
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isAcyclic(t.Field(i).Type, path, done) {
+				return false
+			}
+		}
+	}
+	done[t] = true
+	return true
+}
+
+// isPromoted reports whether sf is an unexported embedded struct or pointer to
+// one. Such a field can't be set, but its exported fields can, as long as
+// the outer struct can be, and encoding/json serializes them.
+func isPromoted(sf reflect.StructField) bool {
+	if sf.IsExported() || !sf.Anonymous {
+		return false
+	}
+	t := sf.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// reachesPointer reports whether a value of type t, reached through an exported
+// field, may hold a nil pointer to a slice, map or struct, which could be
+// allocated.
+func reachesPointer(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		switch t.Elem().Kind() {
+		case reflect.Slice, reflect.Map, reflect.Struct:
+			return true
+		}
+		return reachesPointer(t.Elem(), seen)
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return reachesPointer(t.Elem(), seen)
+	case reflect.Interface:
+		return true
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.IsExported() && reachesPointer(sf.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isMarshaler reports whether t or the pointer to it implements json.Marshaler
+// or encoding.TextMarshaler.
+func isMarshaler(t reflect.Type) bool {
+	return receiverOf(t, marshalerType) != noReceiver || receiverOf(t, textMarshalerType) != noReceiver
+}
+
+// mayBeIrreflexive reports whether a value of the comparable type t may not be
+// equal to itself, because it is or may hold a floating-point number.
+func mayBeIrreflexive(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.Interface:
+		return true
+	case reflect.Array:
+		return mayBeIrreflexive(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if mayBeIrreflexive(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
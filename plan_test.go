@@ -0,0 +1,109 @@
+package niltoempty_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	planA struct {
+		B *planB
+		S []int
+	}
+	planB struct {
+		A *planA
+	}
+	planOuter struct {
+		hidden *planInner
+	}
+	planInner struct {
+		Exported []int
+	}
+)
+
+func TestPlans(t *testing.T) {
+	t.Run("recursive types", func(t *testing.T) {
+		v := planB{A: &planA{B: &planB{A: &planA{}}}}
+
+		niltoempty.Initialize(&v)
+		assert.NotNil(t, v.A.S)
+		assert.NotNil(t, v.A.B.A.S)
+	})
+
+	t.Run("types without maps and slices", func(t *testing.T) {
+		v := struct {
+			Times  []time.Time
+			Ints   map[string][]int
+			Arrays [][2]int
+			Any    any
+		}{
+			Times:  []time.Time{time.Now()},
+			Ints:   map[string][]int{"a": {1}},
+			Arrays: [][2]int{{1, 2}},
+			Any:    time.Now(),
+		}
+
+		assert.Empty(t, niltoempty.InitializeReport(&v).Changes)
+
+		// Elements which can't hold anything to initialize aren't visited,
+		// so many of them fit in a budget counting the visited values.
+		for i := 0; i < 100; i++ {
+			v.Times = append(v.Times, time.Now())
+			v.Ints["a"] = append(v.Ints["a"], i)
+			v.Arrays = append(v.Arrays, [2]int{i, i})
+		}
+		assert.NoError(t, niltoempty.InitializeE(&v, niltoempty.WithMaxNodes(10)))
+	})
+
+	t.Run("same type in different contexts", func(t *testing.T) {
+		v := struct {
+			Inner planInner
+			Outer planOuter
+		}{Outer: planOuter{hidden: &planInner{}}}
+
+		r := niltoempty.InitializeReport(&v)
+		assert.Equal(t, []niltoempty.Path{".Inner.Exported"}, pathsOf(r.Changes))
+		assert.Equal(t, []niltoempty.Path{".Outer.hidden.Exported"}, r.Skipped)
+	})
+}
+
+func pathsOf(changes []niltoempty.Change) []niltoempty.Path {
+	var paths []niltoempty.Path
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+func BenchmarkInitialize(b *testing.B) {
+	type (
+		Item struct {
+			ID      int
+			Created time.Time
+			Tags    []string
+			Attrs   map[string]string
+		}
+		Resp struct {
+			Items  []Item
+			Scores []float64
+			Meta   map[string]any
+		}
+	)
+	items := make([]Item, 100)
+	for i := range items {
+		items[i].Created = time.Now()
+	}
+	scores := make([]float64, 1000)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v := Resp{Items: items, Scores: scores}
+		for j := range items {
+			items[j].Tags, items[j].Attrs = nil, nil
+		}
+		niltoempty.Initialize(&v)
+	}
+}
@@ -0,0 +1,138 @@
+package niltoempty
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry maps types to functions initializing their values. It plugs behavior
+// for types which can't implement Initializer or Skipper, e.g. types of other
+// packages.
+//
+// A registered function is called with a pointer to each value of its type the
+// traversal reaches, instead of traversing the value. A function doing nothing
+// leaves the values of its type untouched. The rules for calling it are the same
+// as for Initializer methods with pointer receivers, except that functions are
+// called regardless of the options and the context: the options don't apply
+// to the values they handle.
+//
+// Functions are meant to be registered before the registry is used, e.g. in
+// init functions. A Registry is safe for concurrent use.
+type Registry struct {
+	// mu serializes the changes of funcs, which is replaced on each of them
+	// so lookups don't need to lock.
+	mu    sync.Mutex
+	funcs atomic.Value // map[reflect.Type]func(reflect.Value)
+
+	// plans caches the type plans of the traversals using the registry, as
+	// the registered types are always visited. gen is the generation of the
+	// global registry the plans were computed for.
+	plans sync.Map // map[reflect.Type]*typePlan
+	gen   uint64
+}
+
+// NewRegistry returns an empty registry, to be passed to WithRegistry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var (
+	// globalRegistry holds the functions registered with RegisterType.
+	globalRegistry = NewRegistry()
+
+	// globalGen is incremented whenever a function is added to globalRegistry.
+	globalGen uint64
+)
+
+// RegisterType registers fn as the way values of type T are initialized by all
+// traversals. See Registry for details.
+//
+// For example, to have the nil Notes of a third party type replaced with
+// a default and to leave its Cache alone:
+//
+//	niltoempty.RegisterType(func(v *vendor.Item) {
+//		if v.Notes == nil {
+//			v.Notes = []string{"n/a"}
+//		}
+//	})
+func RegisterType[T any](fn func(*T)) {
+	Register(globalRegistry, fn)
+}
+
+// Register registers fn in r as the way values of type T are initialized. See
+// Registry for details.
+//
+// When r is passed with WithRegistry, its functions take precedence over the
+// ones registered with RegisterType.
+func Register[T any](r *Registry, fn func(*T)) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	r.set(t, func(v reflect.Value) {
+		fn(v.Addr().Interface().(*T))
+	})
+}
+
+// WithRegistry makes the traversal use the functions registered in r, besides
+// the ones registered with RegisterType.
+func WithRegistry(r *Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+func (r *Registry) set(t reflect.Type, fn func(reflect.Value)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.handlers()
+	funcs := make(map[reflect.Type]func(reflect.Value), len(old)+1)
+	for k, f := range old {
+		funcs[k] = f
+	}
+	funcs[t] = fn
+	r.funcs.Store(funcs)
+
+	if r == globalRegistry {
+		atomic.AddUint64(&globalGen, 1)
+	}
+	r.resetPlans()
+}
+
+// handlers returns the registered functions.
+func (r *Registry) handlers() map[reflect.Type]func(reflect.Value) {
+	funcs, _ := r.funcs.Load().(map[reflect.Type]func(reflect.Value))
+	return funcs
+}
+
+// handler returns the function registered for t, in r or in the global registry.
+func (r *Registry) handler(t reflect.Type) (func(reflect.Value), bool) {
+	if fn, ok := r.handlers()[t]; ok {
+		return fn, true
+	}
+	fn, ok := globalRegistry.handlers()[t]
+	return fn, ok
+}
+
+// resetPlans discards the plans computed before the registered functions changed.
+func (r *Registry) resetPlans() {
+	r.plans.Range(func(k, _ interface{}) bool {
+		r.plans.Delete(k)
+		return true
+	})
+	atomic.StoreUint64(&r.gen, atomic.LoadUint64(&globalGen))
+}
+
+// registryFor returns the registry whose plans and functions the traversal
+// configured with o uses.
+func registryFor(o *options) *Registry {
+	r := o.registry
+	if r == nil {
+		return globalRegistry
+	}
+	if atomic.LoadUint64(&r.gen) != atomic.LoadUint64(&globalGen) {
+		// Functions were added to the global registry since the plans
+		// were computed.
+		r.resetPlans()
+	}
+	return r
+}
@@ -0,0 +1,97 @@
+package niltoempty_test
+
+import (
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+)
+
+// vendorItem stands for a third party type with unexported fields.
+type vendorItem struct {
+	Notes []string
+	cache map[string]int
+}
+
+// vendorSettings is registered with RegisterType only.
+type vendorSettings struct {
+	Values []int
+	id     int
+}
+
+func TestRegistry(t *testing.T) {
+	type Outer struct {
+		Item     vendorItem
+		Items    []vendorItem
+		Settings vendorSettings
+		Other    []int
+	}
+
+	// The plans computed without the functions must not be reused.
+	var before Outer
+	niltoempty.Initialize(&before)
+	assert.Nil(t, before.Item.cache)
+
+	niltoempty.RegisterType(func(v *vendorSettings) {
+		v.id = 42
+	})
+
+	r := niltoempty.NewRegistry()
+	niltoempty.Register(r, func(v *vendorItem) {
+		if v.cache == nil {
+			v.cache = map[string]int{}
+		}
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		v := Outer{Items: []vendorItem{{}}}
+		niltoempty.InitializeWith(&v, niltoempty.WithRegistry(r))
+
+		assert.Equal(t, map[string]int{}, v.Item.cache)
+		assert.Nil(t, v.Item.Notes)
+		assert.Equal(t, map[string]int{}, v.Items[0].cache)
+		assert.Equal(t, 42, v.Settings.id)
+		assert.Nil(t, v.Settings.Values)
+		assert.Equal(t, []int{}, v.Other)
+	})
+
+	t.Run("global", func(t *testing.T) {
+		var v Outer
+		niltoempty.Initialize(&v)
+
+		assert.Nil(t, v.Item.cache)
+		assert.Equal(t, []string{}, v.Item.Notes)
+		assert.Equal(t, 42, v.Settings.id)
+	})
+
+	t.Run("scoped takes precedence", func(t *testing.T) {
+		r := niltoempty.NewRegistry()
+		niltoempty.Register(r, func(*vendorSettings) {})
+
+		var v Outer
+		niltoempty.InitializeWith(&v, niltoempty.WithRegistry(r))
+
+		assert.Equal(t, 0, v.Settings.id)
+		assert.Nil(t, v.Settings.Values)
+	})
+
+	t.Run("registered later", func(t *testing.T) {
+		r := niltoempty.NewRegistry()
+		var v Outer
+		niltoempty.InitializeWith(&v, niltoempty.WithRegistry(r))
+		assert.Equal(t, []string{}, v.Item.Notes)
+
+		niltoempty.Register(r, func(v *[]int) {
+			*v = []int{0}
+		})
+		v = Outer{}
+		niltoempty.InitializeWith(&v, niltoempty.WithRegistry(r))
+		assert.Equal(t, []int{0}, v.Other)
+		assert.Nil(t, v.Settings.Values)
+	})
+
+	t.Run("not used by Find", func(t *testing.T) {
+		v := Outer{}
+		assert.Contains(t, niltoempty.Find(&v, niltoempty.WithRegistry(r)), niltoempty.Path(".Item.Notes"))
+	})
+}
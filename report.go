@@ -0,0 +1,71 @@
+package niltoempty
+
+import (
+	"reflect"
+)
+
+// Report describes what InitializeReport has done.
+type Report struct {
+	// Changes lists all replaced values in the order of the traversal.
+	Changes []Change
+
+	// Maps and Slices count the created maps and slices respectively,
+	// including the ones created behind allocated pointers.
+	Maps   int
+	Slices int
+
+	// Skipped lists nil maps and slices which couldn't be replaced because
+	// they are not settable: unexported fields, exported fields reached through
+	// unexported pointers or elements of values which can't be updated.
+	// Internals of unexported fields are not listed.
+	Skipped []Path
+}
+
+// Change is a single value replaced by InitializeReport, or a value handed
+// over to an Initializer or a registered function.
+type Change struct {
+	Path Path
+
+	// Type is the type of the created or handed over value.
+	Type reflect.Type
+}
+
+// Changed reports whether anything was replaced.
+func (r *Report) Changed() bool {
+	return len(r.Changes) > 0
+}
+
+func (r *Report) add(p Path, t reflect.Type) {
+	r.Changes = append(r.Changes, Change{Path: p, Type: t})
+	r.count(t)
+}
+
+// count counts a created value of type t, when it's a map or a slice.
+func (r *Report) count(t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Map:
+		r.Maps++
+	case reflect.Slice:
+		r.Slices++
+	}
+}
+
+func (r *Report) skip(p Path) {
+	r.Skipped = append(r.Skipped, p)
+}
+
+// InitializeReport works like InitializeWith and returns a report of the
+// replaced and skipped values.
+func InitializeReport(obj interface{}, opts ...Option) Report {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr {
+		panic("niltoempty: expected pointer")
+	}
+
+	var r Report
+	w := newWalker(opts)
+	w.report = &r
+	w.initializeRoot(v)
+
+	return r
+}
@@ -0,0 +1,134 @@
+package niltoempty_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitializeReport(t *testing.T) {
+	type (
+		Inner struct {
+			Items   []int
+			private map[string]int
+		}
+		Resp struct {
+			Items   []int
+			Meta    map[string]any
+			Inner   Inner
+			Any     any
+			At      time.Time
+			Filled  []Inner
+			hidden  *Inner
+			private []int
+		}
+	)
+
+	t.Run("changes", func(t *testing.T) {
+		v := Resp{
+			Meta:   map[string]any{"tags": []string(nil)},
+			Any:    map[int]int(nil),
+			At:     time.Now(),
+			Filled: []Inner{{Items: []int{}}},
+			hidden: &Inner{},
+		}
+
+		r := niltoempty.InitializeReport(&v)
+
+		assert.True(t, r.Changed())
+		assert.Equal(t, []niltoempty.Change{
+			{Path: ".Items", Type: reflect.TypeOf([]int{})},
+			{Path: `.Meta["tags"]`, Type: reflect.TypeOf([]string{})},
+			{Path: ".Inner.Items", Type: reflect.TypeOf([]int{})},
+			{Path: ".Any", Type: reflect.TypeOf(map[int]int{})},
+		}, r.Changes)
+		assert.Equal(t, 1, r.Maps)
+		assert.Equal(t, 3, r.Slices)
+		assert.Equal(t, []niltoempty.Path{
+			".Inner.private",
+			".Filled[0].private",
+			".hidden.Items",
+			".private",
+		}, r.Skipped)
+
+		assert.NotNil(t, v.Items)
+		assert.NotNil(t, v.Inner.Items)
+	})
+
+	t.Run("nothing to change", func(t *testing.T) {
+		v := Inner{Items: []int{}, private: map[string]int{}}
+
+		r := niltoempty.InitializeReport(&v)
+
+		assert.False(t, r.Changed())
+		assert.Empty(t, r.Skipped)
+		assert.Zero(t, r.Maps)
+		assert.Zero(t, r.Slices)
+	})
+
+	t.Run("hooks", func(t *testing.T) {
+		type reportItem struct {
+			Notes []string
+		}
+		type Outer struct {
+			Ordered orderedMap
+			Item    reportItem
+			Other   []int
+		}
+		r := niltoempty.NewRegistry()
+		niltoempty.Register(r, func(v *reportItem) {
+			if v.Notes == nil {
+				v.Notes = []string{"n/a"}
+			}
+		})
+
+		var v Outer
+		report := niltoempty.InitializeReport(&v, niltoempty.WithRegistry(r))
+
+		assert.Equal(t, map[string]int{}, v.Ordered.values)
+		assert.Equal(t, []string{"n/a"}, v.Item.Notes)
+		assert.Equal(t, []niltoempty.Change{
+			{Path: ".Ordered", Type: reflect.TypeOf(orderedMap{})},
+			{Path: ".Item", Type: reflect.TypeOf(reportItem{})},
+			{Path: ".Other", Type: reflect.TypeOf([]int{})},
+		}, report.Changes)
+		assert.Zero(t, report.Maps)
+		assert.Equal(t, 1, report.Slices)
+
+		var want Outer
+		niltoempty.InitializeWith(&want, niltoempty.WithRegistry(r))
+		assert.Equal(t, want, v)
+	})
+
+	t.Run("allocated pointers", func(t *testing.T) {
+		type Outer struct {
+			Items *[]int          `niltoempty:"alloc"`
+			Meta  *map[string]int `niltoempty:"alloc"`
+			Inner *Inner          `niltoempty:"alloc"`
+			Data  *[]byte         `niltoempty:"alloc"`
+		}
+		var v Outer
+
+		r := niltoempty.InitializeReport(&v, niltoempty.WithBytes(niltoempty.BytesNil))
+
+		assert.Equal(t, []niltoempty.Change{
+			{Path: ".Items", Type: reflect.TypeOf(&[]int{})},
+			{Path: ".Meta", Type: reflect.TypeOf(&map[string]int{})},
+			{Path: ".Inner", Type: reflect.TypeOf(&Inner{})},
+			{Path: ".Inner.Items", Type: reflect.TypeOf([]int{})},
+			{Path: ".Data", Type: reflect.TypeOf(&[]byte{})},
+		}, r.Changes)
+		assert.Equal(t, 1, r.Maps)
+		assert.Equal(t, 2, r.Slices)
+		assert.Nil(t, *v.Data)
+	})
+
+	t.Run("panics on non-pointer", func(t *testing.T) {
+		assert.Panics(t, func() {
+			niltoempty.InitializeReport(Inner{})
+		})
+	})
+}
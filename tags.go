@@ -0,0 +1,247 @@
+package niltoempty
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// tagName is the struct tag key controlling how a field is initialized.
+//
+// The tag value is a comma separated list of:
+//   - "-": the field and everything reachable through it is left untouched
+//   - "shallow": the field itself is initialized but the traversal doesn't descend into it
+//   - "alloc": a nil pointer to a slice, map or struct is allocated and initialized
+//   - "cap=N": a slice or map created for the field has capacity N
+//   - "bytes": a nil byte slice is replaced with an empty one under BytesTagged
+//
+// For example:
+//
+//	type Response struct {
+//		Items []Item          `json:"items" niltoempty:"cap=16"`
+//		Meta  *map[string]any `json:"meta" niltoempty:"alloc,shallow"`
+//		Cache map[string]any  `json:"-" niltoempty:"-"`
+//	}
+const tagName = "niltoempty"
+
+// fieldTag is the parsed niltoempty struct tag.
+type fieldTag struct {
+	skip    bool
+	shallow bool
+	alloc   bool
+	bytes   bool
+	cap     int
+
+	// omitEmpty is set for fields tagged with json omitempty when json tags
+	// are honored. Such a field is left nil, but its content is processed.
+	omitEmpty bool
+}
+
+// fieldTag returns the tag of the struct field f, including the json tag
+// when enabled by the options.
+func (w *walker) fieldTag(f *fieldPlan) fieldTag {
+	if !w.opts.jsonTags {
+		return f.tag
+	}
+	ft := f.tag
+	ft.skip = ft.skip || f.json.skip
+	ft.omitEmpty = f.json.omitEmpty
+	return ft
+}
+
+// parseJSONTag parses the parts of the json tag relevant for the traversal.
+func parseJSONTag(tag reflect.StructTag) fieldTag {
+	var ft fieldTag
+
+	jsonTag := tag.Get("json")
+	if jsonTag == "-" {
+		// The field is never serialized; `json:"-,"` names a field "-" instead.
+		ft.skip = true
+		return ft
+	}
+	_, opts, _ := strings.Cut(jsonTag, ",")
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == "omitempty" {
+			ft.omitEmpty = true
+		}
+	}
+	return ft
+}
+
+// parseTag parses the niltoempty tag. Unknown or malformed options are ignored,
+// the same way encoding/json treats its tag options.
+func parseTag(tag reflect.StructTag) fieldTag {
+	var ft fieldTag
+
+	value, ok := tag.Lookup(tagName)
+	if !ok {
+		return ft
+	}
+	if value == "-" {
+		ft.skip = true
+		return ft
+	}
+
+	for _, opt := range strings.Split(value, ",") {
+		switch {
+		case opt == "shallow":
+			ft.shallow = true
+		case opt == "alloc":
+			ft.alloc = true
+		case opt == "bytes":
+			ft.bytes = true
+		case strings.HasPrefix(opt, "cap="):
+			if n, err := strconv.Atoi(strings.TrimPrefix(opt, "cap=")); err == nil && n > 0 {
+				ft.cap = n
+			}
+		}
+	}
+	return ft
+}
+
+// initializeField processes the struct field v according to its tag.
+func (w *walker) initializeField(v reflect.Value, tag fieldTag) {
+	if tag == (fieldTag{}) {
+		w.initializeNils(v)
+		return
+	}
+	if tag.skip {
+		return
+	}
+	if tag.omitEmpty && isNil(v) {
+		return
+	}
+
+	wasNil := v.Kind() == reflect.Pointer && v.IsNil()
+	if tag.alloc && !w.emptyToNil && !w.allocPointer(v, tag) {
+		// The allocation of a recursive struct type was refused to avoid
+		// building an infinite chain, so there is nothing more to do.
+		return
+	}
+
+	// The field itself (or the value it points to) is normalized here,
+	// so the requested capacity can be applied.
+	target := v
+	if target.Kind() == reflect.Pointer && !target.IsNil() {
+		target = target.Elem()
+	}
+	w.normalize(target, tag)
+
+	if tag.shallow {
+		return
+	}
+
+	if wasNil && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		// Mark the newly allocated struct type until the traversal below
+		// is done, so a self-referencing field doesn't allocate forever.
+		t := v.Elem().Type()
+		w.allocating[t] = true
+		defer delete(w.allocating, t)
+	}
+	if wasNil && v.IsNil() {
+		// Nothing was allocated, e.g. because nothing is modified.
+		return
+	}
+	w.initializeNils(v)
+}
+
+// allocPointer allocates a new value for the nil pointer v when it points to
+// a slice, map or struct. It reports false when the allocation was refused
+// because a value of the same struct type is already being allocated on the
+// current path.
+func (w *walker) allocPointer(v reflect.Value, tag fieldTag) bool {
+	if v.Kind() != reflect.Pointer || !v.IsNil() {
+		return true
+	}
+
+	elemType := v.Type().Elem()
+	switch elemType.Kind() {
+	case reflect.Slice, reflect.Map:
+	case reflect.Struct:
+		if w.allocating[elemType] {
+			return false
+		}
+	default:
+		return true
+	}
+
+	// The new value isn't part of the traversed object yet, so it's set
+	// directly rather than reported as a replacement of its own.
+	p := reflect.New(elemType)
+	filled := elemType.Kind() != reflect.Struct && w.enabled(p.Elem()) && !w.encodesItself(p.Elem()) && w.fillsBytes(elemType, tag)
+	if filled {
+		p.Elem().Set(makeEmpty(elemType, tag.cap))
+	}
+	changes := w.changes
+	w.replace(v, p)
+	if filled && w.report != nil && w.changes != changes {
+		// The change is recorded with the pointer type, but the slice or
+		// map behind it is created as well.
+		w.report.count(elemType)
+	}
+	return true
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// encodesItself reports whether v is a slice or map left untouched because its
+// type implements json.Marshaler or encoding.TextMarshaler.
+func (w *walker) encodesItself(v reflect.Value) bool {
+	t := v.Type()
+	return !w.opts.marshalers && t.Name() != "" && w.registry.planFor(t).marshaler
+}
+
+// fillsBytes reports whether a nil value of type t, held by a field tagged
+// with tag, may be replaced according to the BytesPolicy. It's always the
+// case for types other than byte slices.
+func (w *walker) fillsBytes(t reflect.Type, tag fieldTag) bool {
+	if t.Kind() != reflect.Slice || !isByteSlice(t) {
+		return true
+	}
+	switch w.opts.bytes {
+	case BytesNil:
+		return false
+	case BytesTagged:
+		return tag.bytes
+	}
+	return true
+}
+
+// isNil reports whether v is of a nillable kind and is nil.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Chan, reflect.Interface, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+// normalize replaces v with an empty map or slice with the capacity requested
+// by tag, when v is a nil map or slice enabled by the options. When the direction is reversed,
+// an empty map or slice is replaced with nil instead.
+func (w *walker) normalize(v reflect.Value, tag fieldTag) {
+	if !v.IsValid() || !w.enabled(v) {
+		return
+	}
+	if v.Type() == rawMessageType && w.opts.emptyRawMessage != nil {
+		if v.IsNil() && !w.emptyToNil {
+			w.replace(v, reflect.ValueOf(append(json.RawMessage(nil), w.opts.emptyRawMessage...)))
+		}
+		return
+	}
+	if w.encodesItself(v) {
+		return
+	}
+	if w.emptyToNil {
+		if k := v.Kind(); (k == reflect.Map || k == reflect.Slice) && !v.IsNil() && v.Len() == 0 {
+			w.replace(v, reflect.Zero(v.Type()))
+		}
+		return
+	}
+	if v.IsNil() && w.fillsBytes(v.Type(), tag) {
+		w.replace(v, makeEmpty(v.Type(), tag.cap))
+	}
+}
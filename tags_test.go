@@ -0,0 +1,116 @@
+package niltoempty_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTags(t *testing.T) {
+	type Inner struct {
+		S []int `json:"s"`
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		type S struct {
+			Skipped []int   `json:"skipped" niltoempty:"-"`
+			Subtree []Inner `json:"subtree" niltoempty:"-"`
+			Other   []int   `json:"other"`
+		}
+		v := S{Subtree: []Inner{{}}}
+
+		b, err := json.Marshal(niltoempty.Initialize(&v))
+		require.NoError(t, err)
+		assert.Equal(t, `{"skipped":null,"subtree":[{"s":null}],"other":[]}`, string(b))
+	})
+
+	t.Run("shallow", func(t *testing.T) {
+		type S struct {
+			Empty  []Inner         `json:"empty" niltoempty:"shallow"`
+			Full   []Inner         `json:"full" niltoempty:"shallow"`
+			Struct Inner           `json:"struct" niltoempty:"shallow"`
+			Map    map[string]any  `json:"map" niltoempty:"shallow"`
+			Ptr    *map[string]any `json:"ptr" niltoempty:"shallow"`
+		}
+		var m map[string]any
+		v := S{Full: []Inner{{}}, Ptr: &m}
+
+		b, err := json.Marshal(niltoempty.Initialize(&v))
+		require.NoError(t, err)
+		assert.Equal(t, `{"empty":[],"full":[{"s":null}],"struct":{"s":null},"map":{},"ptr":{}}`, string(b))
+	})
+
+	t.Run("alloc", func(t *testing.T) {
+		type S struct {
+			Slice  *[]int          `json:"slice" niltoempty:"alloc"`
+			Map    *map[string]int `json:"map" niltoempty:"alloc"`
+			Struct *Inner          `json:"struct" niltoempty:"alloc"`
+			Int    *int            `json:"int" niltoempty:"alloc"`
+			NoTag  *[]int          `json:"no_tag"`
+		}
+		var v S
+
+		b, err := json.Marshal(niltoempty.Initialize(&v))
+		require.NoError(t, err)
+		assert.Equal(t, `{"slice":[],"map":{},"struct":{"s":[]},"int":null,"no_tag":null}`, string(b))
+	})
+
+	t.Run("alloc shallow", func(t *testing.T) {
+		type S struct {
+			Struct *Inner `json:"struct" niltoempty:"alloc,shallow"`
+		}
+		var v S
+
+		b, err := json.Marshal(niltoempty.Initialize(&v))
+		require.NoError(t, err)
+		assert.Equal(t, `{"struct":{"s":null}}`, string(b))
+	})
+
+	t.Run("alloc recursive type", func(t *testing.T) {
+		type Node struct {
+			S    []int `json:"s"`
+			Next *Node `json:"next" niltoempty:"alloc"`
+		}
+		var v Node
+
+		b, err := json.Marshal(niltoempty.Initialize(&v))
+		require.NoError(t, err)
+		assert.Equal(t, `{"s":[],"next":{"s":[],"next":null}}`, string(b))
+	})
+
+	t.Run("cap", func(t *testing.T) {
+		type S struct {
+			Slice    []int          `niltoempty:"cap=8"`
+			Map      map[string]int `niltoempty:"cap=8"`
+			Ptr      *[]int         `niltoempty:"alloc,cap=4"`
+			Invalid  []int          `niltoempty:"cap=x"`
+			Existing []int          `niltoempty:"cap=8"`
+		}
+		v := S{Existing: make([]int, 0, 1)}
+
+		niltoempty.Initialize(&v)
+		assert.NotNil(t, v.Slice)
+		assert.Equal(t, 8, cap(v.Slice))
+		assert.NotNil(t, v.Map)
+		require.NotNil(t, v.Ptr)
+		assert.Equal(t, 4, cap(*v.Ptr))
+		assert.NotNil(t, v.Invalid)
+		assert.Equal(t, 0, cap(v.Invalid))
+		assert.Equal(t, 1, cap(v.Existing))
+	})
+
+	t.Run("respects options", func(t *testing.T) {
+		type S struct {
+			Slice []int          `niltoempty:"cap=8"`
+			Map   map[string]int `niltoempty:"shallow"`
+		}
+		var v S
+
+		niltoempty.InitializeWith(&v, niltoempty.WithSlices(false), niltoempty.WithMaps(false))
+		assert.Nil(t, v.Slice)
+		assert.Nil(t, v.Map)
+	})
+}
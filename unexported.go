@@ -0,0 +1,88 @@
+package niltoempty
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// WithUnexported controls whether unexported fields are processed the same way
+// as exported ones. Disabled by default.
+//
+// Reflection doesn't allow setting unexported fields, so they are accessed with
+// package unsafe. Values of types from other packages usually rely on their
+// unexported fields being set up by their own code only, and may be shared,
+// like time.UTC, so only the unexported fields declared in the package of the
+// value passed are processed. That is the package declaring its type, or the
+// element type of an unnamed pointer, slice, array or map type; for an unnamed
+// struct type, the package declaring its unexported fields. Unexported fields
+// which can't be addressed, e.g. ones of values stored in maps, are still left
+// untouched.
+//
+// The option is ignored by Clone and Wrap, as their copies share
+// what unexported fields refer to with the original values.
+func WithUnexported(enabled bool) Option {
+	return func(o *options) {
+		o.unexported = enabled
+	}
+}
+
+// exposed returns the unexported field v of an addressable struct as a value
+// which can be set. It reports false when v can't be addressed.
+func exposed(v reflect.Value) (reflect.Value, bool) {
+	if !v.CanAddr() {
+		return v, false
+	}
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem(), true
+}
+
+// ownPackage returns the path of the package whose unexported fields are
+// processed under WithUnexported in a value of type t, as described there,
+// or "" when there is none.
+func ownPackage(t reflect.Type) string {
+	for t.Name() == "" {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+			for i := 0; i < t.NumField(); i++ {
+				if sf := t.Field(i); !sf.IsExported() {
+					return sf.PkgPath
+				}
+			}
+		}
+		return ""
+	}
+	return t.PkgPath()
+}
+
+// reachesUnexported reports whether a value of type t may hold anything the
+// traversal acts on when unexported fields are processed like exported ones.
+// Any pointer is taken into account, as it may be allocated.
+func (r *Registry) reachesUnexported(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	if receiverOf(t, initializerType) != noReceiver {
+		return true
+	}
+	if _, ok := r.handler(t); ok {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Chan, reflect.Interface, reflect.Pointer:
+		return true
+	case reflect.Array:
+		return r.reachesUnexported(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if r.reachesUnexported(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package niltoempty_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	libInner struct {
+		Exported []int
+		hidden   []int
+		index    map[string]int
+	}
+	libOuter struct {
+		inner   libInner
+		ptr     *libInner
+		items   []libInner
+		byName  map[string]*libInner
+		any     any
+		skipped []int `niltoempty:"-"`
+	}
+)
+
+func TestWithUnexported(t *testing.T) {
+	newOuter := func() libOuter {
+		return libOuter{
+			ptr:    &libInner{},
+			items:  []libInner{{}},
+			byName: map[string]*libInner{"a": {}},
+			any:    &libInner{},
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		v := newOuter()
+		niltoempty.Initialize(&v)
+
+		assert.Nil(t, v.inner.hidden)
+		assert.Nil(t, v.ptr.Exported)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		v := newOuter()
+		niltoempty.InitializeWith(&v, niltoempty.WithUnexported(true))
+
+		for _, inner := range []*libInner{&v.inner, v.ptr, &v.items[0], v.byName["a"], v.any.(*libInner)} {
+			assert.Equal(t, []int{}, inner.Exported)
+			assert.Equal(t, []int{}, inner.hidden)
+			assert.Equal(t, map[string]int{}, inner.index)
+		}
+		assert.Nil(t, v.skipped)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		v := libOuter{}
+		assert.Equal(t,
+			[]niltoempty.Path{".inner.Exported", ".inner.hidden", ".inner.index", ".items", ".byName"},
+			niltoempty.Find(&v, niltoempty.WithUnexported(true)))
+	})
+
+	t.Run("unaddressable report", func(t *testing.T) {
+		// Values of NaN keys can't be written back, so their unexported
+		// fields can't be exposed and are reported as skipped.
+		v := map[float64]libOuter{math.NaN(): {}}
+		var r niltoempty.Report
+		require.NotPanics(t, func() {
+			r = niltoempty.InitializeReport(&v, niltoempty.WithUnexported(true))
+		})
+
+		assert.Empty(t, r.Changes)
+		assert.Contains(t, r.Skipped, niltoempty.Path("[NaN].items"))
+		assert.NotContains(t, r.Skipped, niltoempty.Path("[NaN].inner"))
+	})
+
+	t.Run("other packages", func(t *testing.T) {
+		type withLocation struct {
+			Loc   *time.Location
+			names []string
+		}
+		utc := *time.UTC
+
+		v := struct{ Loc *time.Location }{time.UTC}
+		niltoempty.InitializeWith(&v, niltoempty.WithUnexported(true))
+		assert.True(t, reflect.DeepEqual(utc, *time.UTC), "time.UTC is not modified")
+
+		w := withLocation{Loc: time.UTC}
+		niltoempty.InitializeWith(&w, niltoempty.WithUnexported(true))
+		assert.Equal(t, []string{}, w.names)
+		assert.True(t, reflect.DeepEqual(utc, *time.UTC), "time.UTC is not modified")
+	})
+
+	t.Run("ignored by Clone", func(t *testing.T) {
+		v := newOuter()
+		c := niltoempty.Clone(v, niltoempty.WithUnexported(true))
+
+		assert.Nil(t, c.inner.hidden)
+		require.Same(t, v.ptr, c.ptr)
+		assert.Nil(t, v.ptr.hidden)
+	})
+}
@@ -0,0 +1,36 @@
+package niltoempty
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Wrap returns a json.Marshaler producing the same JSON as v would after
+// Initialize, without modifying v. It is safe to use when v is shared, e.g.
+// a cached response served to concurrent requests.
+//
+// The value is cloned on every marshaling, with the same rules as Clone. In
+// particular, InitializeNils methods and registered functions are not called,
+// so what they would set differs from what Initialize produces.
+func Wrap(v interface{}, opts ...Option) json.Marshaler {
+	return wrapped{v: v, opts: opts}
+}
+
+type wrapped struct {
+	v    interface{}
+	opts []Option
+}
+
+func (w wrapped) MarshalJSON() ([]byte, error) {
+	if w.v == nil {
+		return []byte("null"), nil
+	}
+
+	src := reflect.ValueOf(w.v)
+	dst := reflect.New(src.Type()).Elem()
+	if err := initializedCopy(dst, src, w.opts); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(dst.Interface())
+}
@@ -0,0 +1,169 @@
+package niltoempty_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/pkierski/niltoempty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counted modifies the map it shares with its copies when initialized.
+type counted struct {
+	counts map[string]int
+}
+
+func (c *counted) InitializeNils() {
+	for k := range c.counts {
+		c.counts[k]++
+	}
+}
+
+func TestWrap(t *testing.T) {
+	type (
+		Inner struct {
+			S []int          `json:"s"`
+			M map[string]int `json:"m"`
+		}
+		Outer struct {
+			I   Inner            `json:"i"`
+			P   *Inner           `json:"p"`
+			PS  *[]int           `json:"ps"`
+			L   []*Inner         `json:"l"`
+			M   map[string]Inner `json:"m"`
+			Any any              `json:"any"`
+		}
+	)
+	newOuter := func() Outer {
+		return Outer{
+			P:   &Inner{},
+			L:   []*Inner{{}, nil},
+			M:   map[string]Inner{"a": {}},
+			Any: []any{nil, map[string]any(nil)},
+		}
+	}
+
+	t.Run("same JSON as Initialize", func(t *testing.T) {
+		v := newOuter()
+		initialized := newOuter()
+		want, err := json.Marshal(niltoempty.Initialize(&initialized))
+		require.NoError(t, err)
+
+		got, err := json.Marshal(niltoempty.Wrap(v))
+		require.NoError(t, err)
+		assert.JSONEq(t, string(want), string(got))
+
+		got, err = json.Marshal(niltoempty.Wrap(&v))
+		require.NoError(t, err)
+		assert.JSONEq(t, string(want), string(got))
+	})
+
+	t.Run("input is not modified", func(t *testing.T) {
+		v := newOuter()
+		_, err := json.Marshal(niltoempty.Wrap(&v))
+		require.NoError(t, err)
+
+		assert.Equal(t, newOuter(), v)
+		assert.Nil(t, v.P.S)
+		assert.Nil(t, v.L[0].M)
+		assert.Nil(t, v.M["a"].S)
+		assert.Nil(t, v.Any.([]any)[1])
+	})
+
+	t.Run("as field", func(t *testing.T) {
+		v := newOuter()
+		b, err := json.Marshal(map[string]any{"data": niltoempty.Wrap(v.P)})
+		require.NoError(t, err)
+		assert.Equal(t, `{"data":{"s":[],"m":{}}}`, string(b))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		b, err := json.Marshal(niltoempty.Wrap(nil))
+		require.NoError(t, err)
+		assert.Equal(t, `null`, string(b))
+
+		b, err = json.Marshal(niltoempty.Wrap((*Inner)(nil)))
+		require.NoError(t, err)
+		assert.Equal(t, `null`, string(b))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		b, err := json.Marshal(niltoempty.Wrap(Inner{}, niltoempty.WithMaps(false)))
+		require.NoError(t, err)
+		assert.Equal(t, `{"s":[],"m":null}`, string(b))
+	})
+
+	t.Run("shared pointers", func(t *testing.T) {
+		shared := &Inner{}
+		v := Outer{L: []*Inner{shared, shared}}
+
+		b, err := json.Marshal(niltoempty.Wrap(v))
+		require.NoError(t, err)
+		assert.Equal(t, `{"i":{"s":[],"m":{}},"p":null,"ps":null,"l":[{"s":[],"m":{}},{"s":[],"m":{}}],"m":{},"any":null}`, string(b))
+		assert.Nil(t, shared.S)
+	})
+
+	t.Run("cyclic", func(t *testing.T) {
+		type C struct {
+			P *C    `json:"p"`
+			S []int `json:"s"`
+		}
+		v := &C{}
+		v.P = v
+
+		_, err := json.Marshal(niltoempty.Wrap(v))
+		var unsupported *json.UnsupportedValueError
+		assert.ErrorAs(t, err, &unsupported, "cycle is reported by encoding/json like for the original")
+		assert.Nil(t, v.S)
+	})
+
+	t.Run("pointer with options", func(t *testing.T) {
+		v := &Outer{P: &Inner{}}
+		b, err := json.Marshal(niltoempty.Wrap(v, niltoempty.WithPointers(false)))
+		require.NoError(t, err)
+
+		c := *v
+		want, err := json.Marshal(niltoempty.InitializeWith(&c, niltoempty.WithPointers(false)))
+		require.NoError(t, err)
+		assert.JSONEq(t, string(want), string(b))
+		assert.Contains(t, string(b), `"i":{"s":[],"m":{}}`)
+		assert.Contains(t, string(b), `"p":{"s":null,"m":null}`)
+	})
+
+	t.Run("hooks not called", func(t *testing.T) {
+		type Set struct {
+			counted counted
+			Items   []int `json:"items"`
+		}
+		r := niltoempty.NewRegistry()
+		niltoempty.Register(r, func(s *Set) {
+			s.counted.counts["b"]++
+		})
+
+		v := Set{counted: counted{counts: map[string]int{"a": 1}}}
+		b, err := json.Marshal(niltoempty.Wrap(v, niltoempty.WithRegistry(r)))
+		require.NoError(t, err)
+		assert.Equal(t, `{"items":[]}`, string(b))
+		assert.Equal(t, map[string]int{"a": 1}, v.counted.counts)
+
+		c := niltoempty.Clone(v.counted)
+		assert.Equal(t, map[string]int{"a": 1}, c.counts)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		v := newOuter()
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := json.Marshal(niltoempty.Wrap(&v))
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, newOuter(), v)
+	})
+}